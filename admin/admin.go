@@ -0,0 +1,190 @@
+// Package admin serves runtime operations of a service over HTTP: metrics,
+// log level, pprof, build info, the hystrix stream, the Consul registration
+// and the registered gRPC services.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/hystrixconfig"
+	"github.com/richard-xtek/go-grpc-micro-kit/server"
+	"go.uber.org/zap"
+)
+
+const (
+	// TokenHeader carries the admin token. "Authorization: Bearer <token>" is accepted too.
+	TokenHeader = "X-Admin-Token"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// NewServer ...
+func NewServer(logger log.Factory, name string) *Server {
+	return &Server{
+		name:   name,
+		logger: logger,
+	}
+}
+
+// Server is the admin HTTP server. Sensitive endpoints (log level changes,
+// pprof, Consul state and gRPC services) require the admin token; they are
+// refused when no token is configured.
+type Server struct {
+	name  string
+	host  string
+	port  string
+	token string
+
+	logger     log.Factory
+	grpcServer *server.GRPCServer
+	handlers   []handler
+
+	mu     sync.Mutex
+	server *http.Server
+}
+
+type handler struct {
+	pattern   string
+	handler   http.Handler
+	sensitive bool
+}
+
+// WithPort ...
+func (s *Server) WithPort(port string) *Server {
+	s.port = port
+	return s
+}
+
+// WithHost ...
+func (s *Server) WithHost(host string) *Server {
+	s.host = host
+	return s
+}
+
+// WithToken sets the token protecting sensitive endpoints.
+func (s *Server) WithToken(token string) *Server {
+	s.token = token
+	return s
+}
+
+// WithGRPCServer exposes the Consul registration and the services of grpcServer.
+func (s *Server) WithGRPCServer(grpcServer *server.GRPCServer) *Server {
+	s.grpcServer = grpcServer
+	return s
+}
+
+// WithHandler serves an additional handler. Sensitive handlers require the admin token.
+func (s *Server) WithHandler(pattern string, h http.Handler, sensitive bool) *Server {
+	s.handlers = append(s.handlers, handler{pattern: pattern, handler: h, sensitive: sensitive})
+	return s
+}
+
+// GetAddressListen ...
+func (s *Server) GetAddressListen() string {
+	return fmt.Sprintf("%s:%s", s.host, s.port)
+}
+
+// Handler returns the admin endpoints as an http.Handler, e.g. to mount them
+// on another server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/version", http.HandlerFunc(s.serveVersion))
+	mux.Handle("/hystrix.stream", hystrixconfig.StreamHandler())
+	mux.Handle("/log/level", http.HandlerFunc(s.serveLogLevel))
+
+	mux.Handle("/debug/pprof/", s.protect(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", s.protect(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", s.protect(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", s.protect(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", s.protect(http.HandlerFunc(pprof.Trace)))
+	mux.Handle("/consul", s.protect(http.HandlerFunc(s.serveConsul)))
+	mux.Handle("/grpc/services", s.protect(http.HandlerFunc(s.serveGRPCServices)))
+
+	for _, h := range s.handlers {
+		if h.sensitive {
+			mux.Handle(h.pattern, s.protect(h.handler))
+		} else {
+			mux.Handle(h.pattern, h.handler)
+		}
+	}
+
+	return mux
+}
+
+// protect requires the admin token.
+func (s *Server) protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return false
+	}
+
+	token := r.Header.Get(TokenHeader)
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// Start ...
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.GetAddressListen())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.server = &http.Server{Handler: s.Handler()}
+	srv := s.server
+	s.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Bg().Error("Serve "+s.name+" admin server", zap.Error(err))
+		}
+	}()
+	s.logger.Bg().Info("Admin server of " + s.name + " listening on " + ln.Addr().String())
+
+	return nil
+}
+
+// Stop ...
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, shutdownTimeout)
+		defer cancel()
+	}
+	return srv.Shutdown(ctx)
+}
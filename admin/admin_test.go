@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/server"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func TestServer_LogLevel(t *testing.T) {
+	logger := log.NewDevelopFactory("admin_test")
+	h := NewServer(logger, "admin_test").WithToken("secret").Handler()
+
+	do := func(method, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/log/level", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(TokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		rec := do(http.MethodGet, "", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"level":"info"}`, rec.Body.String())
+	})
+
+	t.Run("Set without token", func(t *testing.T) {
+		rec := do(http.MethodPut, `{"level":"debug"}`, "wrong")
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		require.Equal(t, zap.InfoLevel, logger.LogLevel())
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		rec := do(http.MethodPut, `{"level":"debug"}`, "secret")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, zap.DebugLevel, logger.LogLevel())
+	})
+
+	t.Run("Invalid level", func(t *testing.T) {
+		rec := do(http.MethodPut, `{"level":"loud"}`, "secret")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestServer_Protected(t *testing.T) {
+	h := NewServer(log.NewFactory(zap.NewNop()), "admin_test").Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/version", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServer_GRPCServices(t *testing.T) {
+	logger := log.NewFactory(zap.NewNop())
+	grpcServer := server.NewGRPCServer(logger, "admin_test").WithHandler(func(*grpc.Server) {})
+	h := NewServer(logger, "admin_test").WithToken("secret").WithGRPCServer(grpcServer).Handler()
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/grpc/services", nil)
+		req.Header.Set(TokenHeader, "secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// served while the server starts
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	started := make(chan error, 1)
+	go func() {
+		started <- grpcServer.Serve(ln)
+	}()
+	require.Equal(t, http.StatusOK, get().Code)
+	require.NoError(t, <-started)
+	defer grpcServer.Stop(context.Background())
+
+	rec := get()
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "grpc.health.v1.Health")
+}
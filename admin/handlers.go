@@ -0,0 +1,157 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sort"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+)
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X github.com/richard-xtek/go-grpc-micro-kit/admin.Version=1.2.3"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type versionResponse struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+type consulResponse struct {
+	Registered bool        `json:"registered"`
+	ID         string      `json:"id,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Service    interface{} `json:"service,omitempty"`
+	Checks     interface{} `json:"checks,omitempty"`
+}
+
+type grpcMethod struct {
+	Name           string `json:"name"`
+	IsClientStream bool   `json:"client_stream"`
+	IsServerStream bool   `json:"server_stream"`
+}
+
+type grpcService struct {
+	Name    string       `json:"name"`
+	Methods []grpcMethod `json:"methods"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+func (s *Server) serveVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, versionResponse{
+		Service:   s.name,
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	})
+}
+
+// serveLogLevel returns the log level on GET and changes it on PUT/POST with
+// a {"level": "debug"} body. Changing the level requires the admin token.
+func (s *Server) serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	if !s.logger.IsLevelAdjustable() {
+		writeError(w, http.StatusNotImplemented, "log level is not adjustable")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, logLevelRequest{Level: s.logger.LogLevel().String()})
+	case http.MethodPut, http.MethodPost:
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		s.logger.EnableLevel(level)
+		s.logger.Bg().Warn("Log level changed to " + level.String())
+		writeJSON(w, http.StatusOK, logLevelRequest{Level: level.String()})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) serveConsul(w http.ResponseWriter, r *http.Request) {
+	if s.grpcServer == nil || s.grpcServer.GetConsul() == nil {
+		writeJSON(w, http.StatusOK, consulResponse{})
+		return
+	}
+
+	id := s.grpcServer.GetConsulID()
+	if id == "" {
+		writeJSON(w, http.StatusOK, consulResponse{})
+		return
+	}
+
+	status, info, err := s.grpcServer.GetConsul().Status(id)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	resp := consulResponse{Registered: info != nil, ID: id, Status: status}
+	if info != nil {
+		resp.Service = info.Service
+		resp.Checks = info.Checks
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) serveGRPCServices(w http.ResponseWriter, r *http.Request) {
+	services := []grpcService{}
+	var grpcServer *grpc.Server
+	if s.grpcServer != nil {
+		grpcServer = s.grpcServer.GetServer()
+	}
+	if grpcServer != nil {
+		for name, info := range grpcServer.GetServiceInfo() {
+			service := grpcService{Name: name}
+			for _, m := range info.Methods {
+				service.Methods = append(service.Methods, grpcMethod{
+					Name:           m.Name,
+					IsClientStream: m.IsClientStream,
+					IsServerStream: m.IsServerStream,
+				})
+			}
+			services = append(services, service)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	writeJSON(w, http.StatusOK, services)
+}
@@ -0,0 +1,221 @@
+// Package app orchestrates the lifecycle of the components of a service.
+// Components register hooks with their dependencies; Start runs the start
+// hooks in dependency order and Stop runs the stop hooks in reverse order.
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultStartTimeout bounds the start of all hooks.
+	DefaultStartTimeout = 15 * time.Second
+	// DefaultStopTimeout bounds the stop of all hooks when the context passed
+	// to Stop has no deadline.
+	DefaultStopTimeout = 30 * time.Second
+)
+
+// Hook is a component of the application. OnStart and OnStop are optional.
+// A hook starts after the hooks named in DependsOn and stops before them.
+type Hook struct {
+	Name      string
+	DependsOn []string
+
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// New ...
+func New(logger log.Factory, name string) *App {
+	return &App{
+		name:         name,
+		logger:       logger,
+		startTimeout: DefaultStartTimeout,
+		stopTimeout:  DefaultStopTimeout,
+	}
+}
+
+// App runs the hooks of a service.
+type App struct {
+	name   string
+	logger log.Factory
+
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+
+	mu      sync.Mutex
+	hooks   []Hook
+	started []Hook
+}
+
+// WithStartTimeout ...
+func (a *App) WithStartTimeout(timeout time.Duration) *App {
+	a.startTimeout = timeout
+	return a
+}
+
+// WithStopTimeout sets how long Stop waits for the hooks when the context
+// passed to Stop has no deadline.
+func (a *App) WithStopTimeout(timeout time.Duration) *App {
+	a.stopTimeout = timeout
+	return a
+}
+
+// Append registers hooks. Hook names must be unique.
+func (a *App) Append(hooks ...Hook) *App {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hooks = append(a.hooks, hooks...)
+	return a
+}
+
+// order sorts the hooks so every hook follows its dependencies. Independent
+// hooks keep their registration order.
+func (a *App) order() ([]Hook, error) {
+	index := make(map[string]int, len(a.hooks))
+	for i, h := range a.hooks {
+		if _, ok := index[h.Name]; ok {
+			return nil, fmt.Errorf("app: duplicate hook %q", h.Name)
+		}
+		index[h.Name] = i
+	}
+	for _, h := range a.hooks {
+		for _, dep := range h.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("app: hook %q depends on unknown hook %q", h.Name, dep)
+			}
+		}
+	}
+
+	ordered := make([]Hook, 0, len(a.hooks))
+	done := make(map[string]bool, len(a.hooks))
+	for len(ordered) < len(a.hooks) {
+		progress := false
+		for _, h := range a.hooks {
+			if done[h.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range h.DependsOn {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, h)
+				done[h.Name] = true
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("app: dependency cycle between hooks")
+		}
+	}
+	return ordered, nil
+}
+
+// Start runs the start hooks in dependency order. If a hook fails, the hooks
+// already started are stopped in reverse order and the error is returned.
+func (a *App) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.started) > 0 {
+		return fmt.Errorf("app: %s already started", a.name)
+	}
+
+	hooks, err := a.order()
+	if err != nil {
+		return err
+	}
+
+	if a.startTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.startTimeout)
+		defer cancel()
+	}
+
+	for _, h := range hooks {
+		if h.OnStart != nil {
+			a.logger.Bg().Info("Starting " + h.Name)
+			if err := h.OnStart(ctx); err != nil {
+				err = fmt.Errorf("app: start %s: %v", h.Name, err)
+				a.logger.Bg().Error("Start "+h.Name, zap.Error(err))
+
+				if stopErr := a.stop(context.Background()); stopErr != nil {
+					err = multierror.Append(err, stopErr)
+				}
+				return err
+			}
+		}
+		a.started = append(a.started, h)
+	}
+
+	a.logger.Bg().Info("Started " + a.name)
+	return nil
+}
+
+// Stop runs the stop hooks of the started hooks in reverse order. Every stop
+// hook runs even if a previous one fails; the errors are aggregated.
+func (a *App) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.stop(ctx)
+}
+
+func (a *App) stop(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok && a.stopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.stopTimeout)
+		defer cancel()
+	}
+
+	var result error
+	for i := len(a.started) - 1; i >= 0; i-- {
+		h := a.started[i]
+		if h.OnStop == nil {
+			continue
+		}
+
+		a.logger.Bg().Info("Stopping " + h.Name)
+		if err := h.OnStop(ctx); err != nil {
+			a.logger.Bg().Error("Stop "+h.Name, zap.Error(err))
+			result = multierror.Append(result, fmt.Errorf("app: stop %s: %v", h.Name, err))
+		}
+	}
+	a.started = nil
+
+	return result
+}
+
+// Run starts the application and blocks until SIGINT or SIGTERM is received,
+// then stops it.
+func (a *App) Run() error {
+	// listen to signals first, so one received while starting stops the
+	// application once started instead of killing it
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	if err := a.Start(context.Background()); err != nil {
+		return err
+	}
+
+	c := <-sig
+	a.logger.Bg().Info("Received signal " + c.String())
+
+	return a.Stop(context.Background())
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) hook(name string, startErr, stopErr error, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStart: func(ctx context.Context) error {
+			r.events = append(r.events, "start "+name)
+			return startErr
+		},
+		OnStop: func(ctx context.Context) error {
+			r.events = append(r.events, "stop "+name)
+			return stopErr
+		},
+	}
+}
+
+func newApp() *App {
+	return New(log.NewFactory(zap.NewNop()), "test")
+}
+
+func TestApp_StartStop(t *testing.T) {
+	r := &recorder{}
+	a := newApp().Append(
+		r.hook("grpc", nil, nil, "db", "publisher"),
+		r.hook("db", nil, nil),
+		r.hook("publisher", nil, nil, "tracer"),
+		r.hook("tracer", nil, nil),
+	)
+
+	require.NoError(t, a.Start(context.Background()))
+	require.Equal(t, []string{"start db", "start tracer", "start publisher", "start grpc"}, r.events)
+
+	r.events = nil
+	require.NoError(t, a.Stop(context.Background()))
+	require.Equal(t, []string{"stop grpc", "stop publisher", "stop tracer", "stop db"}, r.events)
+}
+
+func TestApp_StartFailure(t *testing.T) {
+	r := &recorder{}
+	startErr := errors.New("boom")
+	a := newApp().Append(
+		r.hook("db", nil, nil),
+		r.hook("grpc", startErr, nil, "db"),
+		r.hook("subscriber", nil, nil, "grpc"),
+	)
+
+	err := a.Start(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+	require.Equal(t, []string{"start db", "start grpc", "stop db"}, r.events)
+}
+
+func TestApp_StopErrors(t *testing.T) {
+	r := &recorder{}
+	a := newApp().Append(
+		r.hook("a", nil, errors.New("a failed")),
+		r.hook("b", nil, nil),
+		r.hook("c", nil, errors.New("c failed")),
+	)
+	require.NoError(t, a.Start(context.Background()))
+
+	err := a.Stop(context.Background())
+	merr, ok := err.(*multierror.Error)
+	require.True(t, ok)
+	require.Len(t, merr.Errors, 2)
+	require.Equal(t, []string{"start a", "start b", "start c", "stop c", "stop b", "stop a"}, r.events)
+}
+
+func TestApp_InvalidDependencies(t *testing.T) {
+	r := &recorder{}
+
+	err := newApp().Append(r.hook("a", nil, nil, "missing")).Start(context.Background())
+	require.Error(t, err)
+
+	err = newApp().Append(r.hook("a", nil, nil, "b"), r.hook("b", nil, nil, "a")).Start(context.Background())
+	require.Error(t, err)
+
+	err = newApp().Append(r.hook("a", nil, nil), r.hook("a", nil, nil)).Start(context.Background())
+	require.Error(t, err)
+
+	require.Empty(t, r.events)
+}
+
+func TestApp_RunSignalWhileStarting(t *testing.T) {
+	r := &recorder{}
+	slow := r.hook("slow", nil, nil)
+	onStart := slow.OnStart
+	slow.OnStart = func(ctx context.Context) error {
+		// received while starting, before Run would wait for it
+		if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+		return onStart(ctx)
+	}
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- newApp().Append(slow).Run()
+	}()
+	select {
+	case err := <-runErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	require.Equal(t, []string{"start slow", "stop slow"}, r.events)
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"io"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/richard-xtek/go-grpc-micro-kit/admin"
+	dialer "github.com/richard-xtek/go-grpc-micro-kit/grpc-dialer"
+	"github.com/richard-xtek/go-grpc-micro-kit/kafka"
+	"github.com/richard-xtek/go-grpc-micro-kit/server"
+	"github.com/richard-xtek/go-grpc-micro-kit/subscriber"
+)
+
+// GRPCServer starts s and stops it gracefully.
+func GRPCServer(name string, s *server.GRPCServer, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStart:   func(ctx context.Context) error { return s.Start() },
+		OnStop:    s.Stop,
+	}
+}
+
+// HTTPServer starts s and stops it gracefully. Do not use it for an HTTP
+// server shared with a GRPCServer through WithHTTPServer.
+func HTTPServer(name string, s *server.HTTPServer, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStart:   func(ctx context.Context) error { return s.Start() },
+		OnStop:    s.Stop,
+	}
+}
+
+// AdminServer starts the admin server s and stops it.
+func AdminServer(name string, s *admin.Server, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStart:   func(ctx context.Context) error { return s.Start() },
+		OnStop:    s.Stop,
+	}
+}
+
+// Prometheus serves the metrics of s on port. The metrics server cannot be
+// stopped.
+func Prometheus(name string, s *server.GRPCServer, port string, isEnableHistogram bool, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStart: func(ctx context.Context) error {
+			s.EnablePrometheus(port, isEnableHistogram)
+			return nil
+		},
+	}
+}
+
+// SubscriberWorker starts and stops the subscribers registered on w.
+func SubscriberWorker(name string, w *subscriber.SubscriberWorker, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStart:   func(ctx context.Context) error { return w.Start() },
+		OnStop:    func(ctx context.Context) error { return w.Stop() },
+	}
+}
+
+// KafkaPublisher closes p on stop. Make the components publishing with p
+// depend on it so they stop first.
+func KafkaPublisher(name string, p *kafka.Publisher, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStop:    func(ctx context.Context) error { return p.Close() },
+	}
+}
+
+// GRPCClientDialer closes the connections cached by d on stop. Make the
+// components calling other services depend on it so they stop first.
+func GRPCClientDialer(name string, d *dialer.GRPCClientDialer, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStop:    func(ctx context.Context) error { return d.Close() },
+	}
+}
+
+// Tracer closes tracer on stop, flushing the buffered spans, when it
+// implements io.Closer as the Jaeger tracer does.
+func Tracer(name string, tracer opentracing.Tracer, dependsOn ...string) Hook {
+	return Hook{
+		Name:      name,
+		DependsOn: dependsOn,
+		OnStop: func(ctx context.Context) error {
+			if closer, ok := tracer.(io.Closer); ok {
+				return closer.Close()
+			}
+			return nil
+		},
+	}
+}
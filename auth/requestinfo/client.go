@@ -0,0 +1,96 @@
+package requestinfo
+
+import (
+	"context"
+	"strings"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ClientOption configures the propagation of the client interceptors.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	authorization bool
+}
+
+// WithAuthorization forwards the bearer token of the end user, the SessionID
+// of the RequestInfo, as the authorization of the calls. Only forward it to
+// the services trusted with the credentials of the users.
+func WithAuthorization() ClientOption {
+	return func(options *clientOptions) {
+		options.authorization = true
+	}
+}
+
+// UnaryClientInterceptor propagates the RequestInfo, the auth.Claim user and
+// the auth.ServiceProviderClaim of ctx to the called service, with the keys
+// read by Authentication. caller is appended to the chain of callers.
+// Keys already set in the outgoing metadata are kept.
+func UnaryClientInterceptor(caller string, options ...ClientOption) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(OutgoingContext(ctx, caller, options...), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor is the stream counterpart of UnaryClientInterceptor.
+func StreamClientInterceptor(caller string, options ...ClientOption) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(OutgoingContext(ctx, caller, options...), desc, cc, method, opts...)
+	}
+}
+
+// OutgoingContext returns ctx with the outgoing metadata written by
+// UnaryClientInterceptor. The authorization of the end user is only
+// forwarded WithAuthorization. The called service reads the claim user and
+// the provider only over mTLS, see Authentication.
+func OutgoingContext(ctx context.Context, caller string, options ...ClientOption) context.Context {
+	var o clientOptions
+	for _, option := range options {
+		option(&o)
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	set := func(key, value string) {
+		if value != "" && len(md[key]) == 0 {
+			md[key] = []string{value}
+		}
+	}
+
+	var (
+		claimUserID string
+		callers     []string
+	)
+	if info, ok := ExtractRequestInfo(ctx); ok && info != nil {
+		set(ClientIPKey, info.ClientIP)
+		set(UserAgentKey, info.UserAgent)
+		set(UserIDRequestKey, info.UserID)
+		set(SessionIDAuthorizeRequestKey, info.SessionIDForAuthorize)
+		claimUserID = info.ClaimUserID
+		if o.authorization && info.SessionID != "" {
+			set(AuthHeaderKey, "Bearer "+info.SessionID)
+		}
+		callers = info.Callers
+	}
+	if claim, ok := auth.FromContext(ctx); ok && claim != nil {
+		// the claim of this service wins over the one it received
+		claimUserID = claim.Token.UserID
+	}
+	set(ClaimUserIDKey, claimUserID)
+	if provider, ok := auth.ProviderFromContext(ctx); ok {
+		set(ProviderIDKey, provider.ID)
+		set(ProviderCodenameKey, provider.Codename)
+		set(ProviderNameKey, provider.Name)
+	}
+
+	if len(md[CallerChainKey]) == 0 && caller != "" {
+		chain := make([]string, 0, len(callers)+1)
+		chain = append(chain, callers...)
+		md[CallerChainKey] = []string{strings.Join(append(chain, caller), ",")}
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
@@ -0,0 +1,100 @@
+package requestinfo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/auth"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestOutgoingContext(t *testing.T) {
+	ctx := NewContext(context.Background(), &RequestInfo{
+		UserID:    "user-1",
+		ClientIP:  "10.0.0.1",
+		SessionID: "session",
+		UserAgent: "curl",
+		Callers:   []string{"gateway"},
+	})
+	ctx = auth.NewContext(ctx, &auth.Claim{Token: auth.Token{UserID: "user-2"}})
+	ctx = auth.NewContextWithProvider(ctx, auth.ServiceProviderClaim{ID: "p1", Codename: "acme", Name: "Acme"})
+	ctx = metadata.AppendToOutgoingContext(ctx, UserAgentKey, "explicit")
+
+	md, _ := metadata.FromOutgoingContext(OutgoingContext(ctx, "payment", WithAuthorization()))
+	require.Equal(t, []string{"explicit"}, md[UserAgentKey], "explicit keys are kept")
+
+	// the called service reads what the caller wrote
+	newCtx, err := Authentication(log.NewFactory(zap.NewNop()))(metadata.NewIncomingContext(verifiedPeer(), md), "/svc/Method")
+	require.NoError(t, err)
+	info, ok := ExtractRequestInfo(newCtx)
+	require.True(t, ok)
+	require.Equal(t, &RequestInfo{
+		UserID:      "user-1",
+		ClientIP:    "10.0.0.1",
+		SessionID:   "session",
+		UserAgent:   "explicit",
+		ClaimUserID: "user-2",
+		Callers:     []string{"gateway", "payment"},
+	}, info)
+	provider, ok := auth.ProviderFromContext(newCtx)
+	require.True(t, ok)
+	require.Equal(t, auth.ServiceProviderClaim{ID: "p1", Codename: "acme", Name: "Acme"}, provider)
+}
+
+func TestOutgoingContext_authorization(t *testing.T) {
+	ctx := NewContext(context.Background(), &RequestInfo{SessionID: "session"})
+
+	md, _ := metadata.FromOutgoingContext(OutgoingContext(ctx, "payment"))
+	require.NotContains(t, md, AuthHeaderKey, "forwarded on demand only")
+
+	md, _ = metadata.FromOutgoingContext(OutgoingContext(ctx, "payment", WithAuthorization()))
+	require.Equal(t, []string{"Bearer session"}, md[AuthHeaderKey])
+}
+
+func TestAuthentication(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	authenticate := Authentication(log.NewFactory(zap.New(core)))
+	md := metadata.Pairs(
+		ClaimUserIDKey, "user-2",
+		ProviderIDKey, "p1",
+		ProviderCodenameKey, "acme",
+	)
+
+	t.Run("Unauthenticated peer", func(t *testing.T) {
+		ctx, err := authenticate(metadata.NewIncomingContext(context.Background(), md), "/svc/Method")
+		require.NoError(t, err)
+		info, _ := ExtractRequestInfo(ctx)
+		require.Empty(t, info.ClaimUserID)
+		_, ok := auth.ProviderFromContext(ctx)
+		require.False(t, ok, "the provider is set by authenticated services only")
+		require.Equal(t, 1, logs.FilterMessage("Dropped the service keys of an unverified peer").Len())
+	})
+
+	t.Run("No provider", func(t *testing.T) {
+		ctx, err := authenticate(metadata.NewIncomingContext(verifiedPeer(), metadata.Pairs(ClaimUserIDKey, "user-2")), "/svc/Method")
+		require.NoError(t, err)
+		info, _ := ExtractRequestInfo(ctx)
+		require.Equal(t, "user-2", info.ClaimUserID)
+		_, ok := auth.ProviderFromContext(ctx)
+		require.False(t, ok)
+	})
+}
+
+// verifiedPeer returns a context whose peer presented a verified client
+// certificate.
+func verifiedPeer() context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "gateway"}}}},
+		}},
+	})
+}
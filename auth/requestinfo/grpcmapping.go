@@ -3,8 +3,11 @@ package requestinfo
 import (
 	"context"
 
+	"github.com/richard-xtek/go-grpc-micro-kit/auth"
 	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/tlsconfig"
 
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
@@ -28,7 +31,10 @@ func UnaryServerAuth(authFunc AuthFunc) grpc.UnaryServerInterceptor {
 	}
 }
 
-// Authentication ...
+// Authentication builds the RequestInfo of a call from its metadata. The
+// ClaimUserID and the auth.ServiceProviderClaim, see IsServiceKey, are only
+// read from the services authenticated by a verified client certificate, the
+// ones sent by other peers are dropped and logged at debug level.
 func Authentication(log log.Factory) AuthFunc {
 	return func(ctx context.Context, fullMethod string) (context.Context, error) {
 		md, _ := metadata.FromIncomingContext(ctx)
@@ -38,8 +44,20 @@ func Authentication(log log.Factory) AuthFunc {
 			SessionID:             getSessionID(md),
 			UserID:                getUserIDRequest(md),
 			SessionIDForAuthorize: getSessionIDAuthorize(md),
+			Callers:               getCallers(md),
+		}
+		_, trusted := tlsconfig.PeerIdentity(ctx)
+		if trusted {
+			info.ClaimUserID = getClaimUserID(md)
+		} else if keys := serviceKeys(md); len(keys) > 0 {
+			log.For(ctx).Debug("Dropped the service keys of an unverified peer", zap.String("method", fullMethod), zap.Strings("keys", keys))
 		}
 		newCtx := NewContext(ctx, &info)
+		if _, ok := auth.ProviderFromContext(newCtx); !ok && trusted {
+			if provider := getProvider(md); provider.ID != "" {
+				newCtx = auth.NewContextWithProvider(newCtx, provider)
+			}
+		}
 		return newCtx, nil
 	}
 }
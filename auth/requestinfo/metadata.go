@@ -3,6 +3,7 @@ package requestinfo
 import (
 	"strings"
 
+	"github.com/richard-xtek/go-grpc-micro-kit/auth"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -17,8 +18,41 @@ const (
 	UserIDRequestKey = "grpcgateway-user-id-request"
 	// SessionIDAuthorizeRequestKey ...
 	SessionIDAuthorizeRequestKey = "grpcgateway-session-id-authorize"
+	// ClaimUserIDKey is the user of the auth.Claim of the calling service.
+	ClaimUserIDKey = "grpcgateway-claim-user-id"
+	// ProviderIDKey ...
+	ProviderIDKey = "grpcgateway-provider-id"
+	// ProviderCodenameKey ...
+	ProviderCodenameKey = "grpcgateway-provider-codename"
+	// ProviderNameKey ...
+	ProviderNameKey = "grpcgateway-provider-name"
+	// CallerChainKey lists the services the request went through, comma
+	// separated, the closest caller last.
+	CallerChainKey = "grpcgateway-caller-chain"
 )
 
+// IsServiceKey reports whether key, in lower case, is set by the calling
+// services only: the claim user and the service provider. Gateways must not
+// forward them from their clients.
+func IsServiceKey(key string) bool {
+	switch key {
+	case ClaimUserIDKey, ProviderIDKey, ProviderCodenameKey, ProviderNameKey:
+		return true
+	}
+	return false
+}
+
+// serviceKeys returns the keys of md set by the calling services only.
+func serviceKeys(md metadata.MD) []string {
+	var keys []string
+	for key := range md {
+		if IsServiceKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 func getHeaderString(md metadata.MD, key string, defaultValue ...string) string {
 	values := md[key]
 	value := ""
@@ -47,6 +81,26 @@ func getSessionIDAuthorize(md metadata.MD) string {
 	return getHeaderString(md, SessionIDAuthorizeRequestKey)
 }
 
+func getClaimUserID(md metadata.MD) string {
+	return getHeaderString(md, ClaimUserIDKey)
+}
+
+func getProvider(md metadata.MD) auth.ServiceProviderClaim {
+	return auth.ServiceProviderClaim{
+		ID:       getHeaderString(md, ProviderIDKey),
+		Codename: getHeaderString(md, ProviderCodenameKey),
+		Name:     getHeaderString(md, ProviderNameKey),
+	}
+}
+
+func getCallers(md metadata.MD) []string {
+	chain := getHeaderString(md, CallerChainKey)
+	if chain == "" {
+		return nil
+	}
+	return strings.Split(chain, ",")
+}
+
 func getSessionID(md metadata.MD) string {
 	// Check header Authorization
 	auth := getHeaderString(md, AuthHeaderKey)
@@ -7,4 +7,8 @@ type RequestInfo struct {
 	SessionID             string
 	UserAgent             string
 	SessionIDForAuthorize string
+	// ClaimUserID is the user authenticated by the calling service
+	ClaimUserID string
+	// Callers are the services the request went through, the closest last
+	Callers []string
 }
@@ -0,0 +1,275 @@
+// Package config loads the configuration of a service from files,
+// environment variables and flags, and builds the kit components from it.
+//
+// A service embeds Config in its own config struct:
+//
+//	type PaymentConfig struct {
+//		config.Config `yaml:",inline"`
+//		FeeRate float64 `yaml:"fee_rate" valid:"range(0|1)"`
+//	}
+//
+//	var cfg PaymentConfig
+//	err := config.NewLoader("PAYMENT").
+//		WithFile("config.yaml").
+//		WithFlagSet(flag.CommandLine, os.Args[1:]).
+//		Load(&cfg)
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	opentracing "github.com/opentracing/opentracing-go"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	"github.com/richard-xtek/go-grpc-micro-kit/kafka"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/redis"
+	"github.com/richard-xtek/go-grpc-micro-kit/registry"
+	"github.com/richard-xtek/go-grpc-micro-kit/server"
+	"github.com/richard-xtek/go-grpc-micro-kit/tracing"
+)
+
+// Config is the configuration of the kit components.
+type Config struct {
+	Service ServiceConfig `yaml:"service"`
+	Log     LogConfig     `yaml:"log"`
+	Tracing TracingConfig `yaml:"tracing"`
+	Consul  ConsulConfig  `yaml:"consul"`
+	Redis   RedisConfig   `yaml:"redis"`
+	Kafka   KafkaConfig   `yaml:"kafka"`
+
+	Discovery DiscoveryConfig `yaml:"discovery"`
+}
+
+// ServiceConfig ...
+type ServiceConfig struct {
+	Name            string        `yaml:"name" usage:"service name"`
+	Host            string        `yaml:"host" usage:"gRPC listen host"`
+	Port            string        `yaml:"port" valid:"port" usage:"gRPC listen port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" usage:"graceful shutdown timeout"`
+
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig enables TLS when CertFile is set and mutual TLS when CAFile is
+// set too.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" usage:"TLS certificate file"`
+	KeyFile  string `yaml:"key_file" usage:"TLS key file"`
+	CAFile   string `yaml:"ca_file" usage:"CA file verifying client certificates"`
+}
+
+// LogConfig ...
+type LogConfig struct {
+	Folder      string `yaml:"folder" usage:"log folder"`
+	Level       string `yaml:"level" usage:"log level: debug, info, warn, error"`
+	Development bool   `yaml:"development" usage:"log to stdout in a human readable format"`
+}
+
+// TracingConfig ...
+type TracingConfig struct {
+	Disabled bool   `yaml:"disabled" usage:"disable tracing"`
+	Endpoint string `yaml:"endpoint" usage:"Jaeger agent host:port or collector http:// URL"`
+}
+
+// ConsulConfig ...
+type ConsulConfig struct {
+	Address          string        `yaml:"address" usage:"Consul address"`
+	Register         bool          `yaml:"register" usage:"register the gRPC server in Consul"`
+	Tags             []string      `yaml:"tags" usage:"Consul service tags"`
+	AdvertiseAddress string        `yaml:"advertise_address" usage:"address registered in Consul, the local IP when empty"`
+	TTL              time.Duration `yaml:"ttl" usage:"check the registered server by a TTL heartbeat instead of gRPC"`
+}
+
+// Discovery types.
+const (
+	DiscoveryConsul = "consul"
+	DiscoveryStatic = "static"
+	DiscoveryFile   = "file"
+	DiscoveryDNS    = "dns"
+)
+
+// DiscoveryConfig selects how the called services are found, Consul by
+// default:
+//
+//	discovery:
+//	  type: static
+//	  static:
+//	    payment: ["127.0.0.1:9000"]
+type DiscoveryConfig struct {
+	Type      string              `yaml:"type" usage:"service discovery: consul, static, file or dns"`
+	Static    map[string][]string `yaml:"static"`
+	File      string              `yaml:"file" usage:"YAML or JSON file listing the addresses of each service"`
+	DNSDomain string              `yaml:"dns_domain" usage:"domain of the DNS SRV records"`
+}
+
+// RedisConfig ...
+type RedisConfig struct {
+	Address string `yaml:"address" usage:"Redis URL, e.g. redis://localhost:6379/0"`
+}
+
+// KafkaConfig ...
+type KafkaConfig struct {
+	Brokers       []string `yaml:"brokers" usage:"Kafka brokers"`
+	ConsumerGroup string   `yaml:"consumer_group" usage:"Kafka consumer group"`
+}
+
+// Validate checks the required fields and the fields depending on each other.
+func (c Config) Validate() error {
+	if c.Service.Name == "" {
+		return errors.New("service.name is required")
+	}
+	if c.Service.Port == "" {
+		return errors.New("service.port is required")
+	}
+	if c.Log.Level != "" {
+		if _, err := c.logLevel(); err != nil {
+			return err
+		}
+	}
+	if !c.Log.Development && c.Log.Folder == "" {
+		return errors.New("log.folder is required unless log.development is set")
+	}
+	if (c.Service.TLS.CertFile == "") != (c.Service.TLS.KeyFile == "") {
+		return errors.New("service.tls.cert_file and service.tls.key_file must be set together")
+	}
+	if c.Service.TLS.CAFile != "" && c.Service.TLS.CertFile == "" {
+		return errors.New("service.tls.ca_file requires service.tls.cert_file")
+	}
+	if c.Consul.Register && c.Consul.Address == "" {
+		return errors.New("consul.register requires consul.address")
+	}
+	switch c.Discovery.Type {
+	case "", DiscoveryConsul, DiscoveryStatic, DiscoveryDNS:
+	case DiscoveryFile:
+		if c.Discovery.File == "" {
+			return errors.New("discovery.file is required by the file discovery")
+		}
+	default:
+		return fmt.Errorf("unknown discovery.type %q", c.Discovery.Type)
+	}
+	return nil
+}
+
+func (c Config) logLevel() (zapcore.Level, error) {
+	level := zapcore.InfoLevel
+	if c.Log.Level == "" {
+		return level, nil
+	}
+	err := level.UnmarshalText([]byte(c.Log.Level))
+	return level, err
+}
+
+// NewLogger builds the log factory.
+func (c Config) NewLogger() (log.Factory, error) {
+	level, err := c.logLevel()
+	if err != nil {
+		return log.Factory{}, err
+	}
+
+	if c.Log.Development {
+		logger := log.NewDevelopFactory(c.Service.Name)
+		logger.EnableLevel(level)
+		return logger, nil
+	}
+	return log.NewLogFactory(c.Log.Folder, c.Service.Name, level), nil
+}
+
+// NewTracer builds the Jaeger tracer, or a no-op tracer when tracing is
+// disabled.
+func (c Config) NewTracer(logger log.Factory) opentracing.Tracer {
+	if c.Tracing.Disabled {
+		return opentracing.NoopTracer{}
+	}
+	return tracing.Init(c.Service.Name, logger, c.Tracing.Endpoint)
+}
+
+// NewConsulClient ...
+func (c Config) NewConsulClient() (*consul.Client, error) {
+	return registry.NewClient(c.Consul.Address)
+}
+
+// NewDiscovery builds the configured service discovery, for
+// dialer.WithDiscovery. consulClient may be nil unless the discovery is
+// Consul.
+func (c Config) NewDiscovery(logger log.Factory, consulClient *consul.Client) (discovery.Discovery, error) {
+	switch c.Discovery.Type {
+	case DiscoveryStatic:
+		return discovery.NewStatic(c.Discovery.Static), nil
+	case DiscoveryFile:
+		return discovery.NewFile(c.Discovery.File, logger), nil
+	case DiscoveryDNS:
+		return discovery.NewDNS(c.Discovery.DNSDomain, logger), nil
+	}
+	if consulClient == nil {
+		return nil, errors.New("config: the consul discovery requires a Consul client")
+	}
+	return discovery.NewConsul(consulClient, logger), nil
+}
+
+// NewRedisStore ...
+func (c Config) NewRedisStore() (redis.Client, error) {
+	if c.Redis.Address == "" {
+		return nil, errors.New("config: redis.address is required")
+	}
+	return redis.NewWithPool(c.Redis.Address), nil
+}
+
+// NewKafkaPublisher ...
+func (c Config) NewKafkaPublisher(logger log.Factory, marshaler kafka.Marshaler) (*kafka.Publisher, error) {
+	return kafka.NewPublisher(kafka.PublisherConfig{
+		Brokers:   c.Kafka.Brokers,
+		Marshaler: marshaler,
+	}, logger)
+}
+
+// NewKafkaSubscriber ...
+func (c Config) NewKafkaSubscriber(logger log.Factory, unmarshaler kafka.Unmarshaler) (*kafka.Subscriber, error) {
+	return kafka.NewSubscriber(kafka.SubscriberConfig{
+		Brokers:       c.Kafka.Brokers,
+		Unmarshaler:   unmarshaler,
+		ConsumerGroup: c.Kafka.ConsumerGroup,
+	}, logger)
+}
+
+// NewGRPCServer builds the gRPC server listening on the configured address,
+// with TLS when configured. It registers in Consul through consulClient when
+// consul.register is set; consulClient may be nil otherwise.
+func (c Config) NewGRPCServer(logger log.Factory, tracer opentracing.Tracer, consulClient *consul.Client) (*server.GRPCServer, error) {
+	s := server.NewGRPCServer(logger, c.Service.Name).
+		WithHost(c.Service.Host).
+		WithPort(c.Service.Port).
+		WithTracer(tracer)
+
+	if c.Service.ShutdownTimeout > 0 {
+		s.WithShutdownTimeout(c.Service.ShutdownTimeout)
+	}
+
+	tlsCfg := c.Service.TLS
+	if tlsCfg.CAFile != "" {
+		s.WithMTLS(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.CAFile)
+	} else if tlsCfg.CertFile != "" {
+		s.WithTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+	}
+
+	if c.Consul.Register {
+		if consulClient == nil {
+			return nil, errors.New("config: consul.register requires a Consul client")
+		}
+		port, err := strconv.Atoi(c.Service.Port)
+		if err != nil {
+			return nil, err
+		}
+		consulRegister := registry.NewConsulRegister(consulClient, c.Service.Name, port, c.Consul.Tags)
+		consulRegister.Address = c.Consul.AdvertiseAddress
+		consulRegister.TTL = c.Consul.TTL
+		s.WithConsul(consulRegister)
+	}
+
+	return s, nil
+}
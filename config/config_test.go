@@ -0,0 +1,125 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type serviceConfig struct {
+	Config  `yaml:",inline"`
+	FeeRate float64 `yaml:"fee_rate"`
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoader_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	yamlFile := writeFile(t, dir, "config.yaml", `
+service:
+  name: payment
+  port: "8080"
+  shutdown_timeout: 10s
+log:
+  development: true
+  level: warn
+kafka:
+  brokers: [a:9092, b:9092]
+fee_rate: 0.5
+`)
+	jsonFile := writeFile(t, dir, "override.json", `{"service": {"host": "10.0.0.1"}, "fee_rate": 0.7}`)
+
+	os.Setenv("CFGTEST_SERVICE_PORT", "9090")
+	os.Setenv("CFGTEST_KAFKA_BROKERS", "c:9092,d:9092")
+	os.Setenv("CFGTEST_LOG_LEVEL", "error")
+	defer os.Unsetenv("CFGTEST_SERVICE_PORT")
+	defer os.Unsetenv("CFGTEST_KAFKA_BROKERS")
+	defer os.Unsetenv("CFGTEST_LOG_LEVEL")
+
+	cfg := serviceConfig{FeeRate: 0.1}
+	cfg.Tracing.Disabled = true
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	err = NewLoader("CFGTEST").
+		WithFile(yamlFile, jsonFile).
+		WithFlagSet(fs, []string{"-log.level=debug", "-consul.tags=a,b"}).
+		Load(&cfg)
+	require.NoError(t, err)
+
+	require.Equal(t, "payment", cfg.Service.Name)
+	require.Equal(t, "10.0.0.1", cfg.Service.Host, "later files override earlier ones")
+	require.Equal(t, "9090", cfg.Service.Port, "env overrides files")
+	require.Equal(t, 10*time.Second, cfg.Service.ShutdownTimeout)
+	require.Equal(t, []string{"c:9092", "d:9092"}, cfg.Kafka.Brokers)
+	require.Equal(t, "debug", cfg.Log.Level, "flags override env")
+	require.Equal(t, []string{"a", "b"}, cfg.Consul.Tags)
+	require.Equal(t, 0.7, cfg.FeeRate)
+	require.True(t, cfg.Tracing.Disabled, "defaults are kept")
+
+	logger, err := cfg.NewLogger()
+	require.NoError(t, err)
+	require.Equal(t, "debug", logger.LogLevel().String())
+
+	s, err := cfg.NewGRPCServer(logger, cfg.NewTracer(logger), nil)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1:9090", s.GetAddressListen())
+}
+
+func TestLoader_flags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader("").WithFlagSet(fs, []string{"-service.name=payment", "-log.development", "-tracing.disabled=false", "-service.port=8080"})
+
+	var cfg Config
+	cfg.Tracing.Disabled = true
+	require.NoError(t, loader.Load(&cfg))
+	require.True(t, cfg.Log.Development, "bool flags need no value")
+	require.False(t, cfg.Tracing.Disabled)
+	require.Equal(t, "8080", cfg.Service.Port)
+
+	var again Config
+	require.NoError(t, loader.Load(&again), "flags are defined once per flag set")
+	require.Equal(t, cfg, again)
+}
+
+func TestLoader_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{{
+		"Missing name",
+		Config{Service: ServiceConfig{Port: "8080"}, Log: LogConfig{Development: true}},
+	}, {
+		"Invalid port",
+		Config{Service: ServiceConfig{Name: "a", Port: "http"}, Log: LogConfig{Development: true}},
+	}, {
+		"Invalid log level",
+		Config{Service: ServiceConfig{Name: "a", Port: "8080"}, Log: LogConfig{Development: true, Level: "loud"}},
+	}, {
+		"Missing log folder",
+		Config{Service: ServiceConfig{Name: "a", Port: "8080"}},
+	}, {
+		"TLS key without certificate",
+		Config{Service: ServiceConfig{Name: "a", Port: "8080", TLS: TLSConfig{KeyFile: "key.pem"}}, Log: LogConfig{Development: true}},
+	}, {
+		"Unknown discovery",
+		Config{Service: ServiceConfig{Name: "a", Port: "8080"}, Log: LogConfig{Development: true}, Discovery: DiscoveryConfig{Type: "etcd"}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			require.Error(t, NewLoader("").Load(&cfg))
+		})
+	}
+}
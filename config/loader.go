@@ -0,0 +1,311 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigFlag is the flag naming an extra config file, loaded after the files
+// given to WithFile.
+const ConfigFlag = "config"
+
+// Validator is implemented by config structs with checks beyond the `valid`
+// struct tags.
+type Validator interface {
+	Validate() error
+}
+
+// NewLoader returns a loader reading environment variables prefixed with
+// prefix, e.g. prefix "PAYMENT" reads PAYMENT_SERVICE_PORT into service.port.
+func NewLoader(prefix string) *Loader {
+	return &Loader{prefix: prefix}
+}
+
+// Loader fills a config struct from, by increasing precedence: the values
+// already in the struct, the config files, the environment variables and the
+// command line flags. Keys are the yaml tags of the fields, falling back to
+// the lowercased field names. The key service.port is read from:
+//
+//	service:          # YAML or JSON file
+//	  port: "8080"
+//	PREFIX_SERVICE_PORT=8080
+//	-service.port=8080
+//
+// Slices are comma separated in environment variables and flags. After
+// loading, the struct is validated with its `valid` tags (govalidator) and its
+// Validate method if any.
+type Loader struct {
+	prefix string
+	files  []string
+
+	flagSet *flag.FlagSet
+	args    []string
+}
+
+// WithFile adds config files, YAML or JSON. Later files override earlier ones.
+func (l *Loader) WithFile(paths ...string) *Loader {
+	l.files = append(l.files, paths...)
+	return l
+}
+
+// WithFlagSet defines a flag per config key, plus the -config flag, on fs and
+// parses args with it, e.g. flag.CommandLine and os.Args[1:].
+func (l *Loader) WithFlagSet(fs *flag.FlagSet, args []string) *Loader {
+	l.flagSet = fs
+	l.args = args
+	return l
+}
+
+// field is a settable leaf of the config struct.
+type field struct {
+	path  []string
+	value reflect.Value
+	usage string
+}
+
+// Load fills v, a pointer to a struct.
+func (l *Loader) Load(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load expects a pointer to a struct, got %T", v)
+	}
+
+	files := l.files
+	if l.flagSet != nil {
+		l.defineFlag(ConfigFlag, "config file, YAML or JSON", false)
+		for _, f := range collectFields(rv.Elem(), nil) {
+			l.defineFlag(strings.Join(f.path, "."), f.usage, f.value.Kind() == reflect.Bool)
+		}
+		if err := l.flagSet.Parse(l.args); err != nil {
+			return err
+		}
+		if configFile := l.flagSet.Lookup(ConfigFlag).Value.String(); configFile != "" {
+			files = append(files, configFile)
+		}
+	}
+
+	for _, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("config: %v", err)
+		}
+		// JSON is a subset of YAML; the YAML decoder also handles durations
+		if err := yaml.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("config: parse %s: %v", path, err)
+		}
+	}
+
+	// collect again: files may have allocated nested pointers
+	fields := collectFields(rv.Elem(), nil)
+
+	for _, f := range fields {
+		name := strings.ToUpper(strings.Join(f.path, "_"))
+		if l.prefix != "" {
+			name = strings.ToUpper(l.prefix) + "_" + name
+		}
+		if s, ok := os.LookupEnv(name); ok {
+			if err := setValue(f.value, s); err != nil {
+				return fmt.Errorf("config: env %s: %v", name, err)
+			}
+		}
+	}
+
+	if l.flagSet != nil {
+		set := make(map[string]bool)
+		l.flagSet.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+		for _, f := range fields {
+			name := strings.Join(f.path, ".")
+			if !set[name] {
+				continue
+			}
+			if err := setValue(f.value, l.flagSet.Lookup(name).Value.String()); err != nil {
+				return fmt.Errorf("config: flag -%s: %v", name, err)
+			}
+		}
+	}
+
+	return validate(v)
+}
+
+// defineFlag defines the flag name unless the flag set already has it, e.g.
+// from a previous Load. Bool flags may be given without a value.
+func (l *Loader) defineFlag(name, usage string, isBool bool) {
+	if l.flagSet.Lookup(name) == nil {
+		l.flagSet.Var(&flagValue{isBool: isBool}, name, usage)
+	}
+}
+
+// flagValue holds the raw value of a flag, parsed with the other sources once
+// the files and environment variables are loaded.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(s string) error {
+	f.value = s
+	return nil
+}
+
+// IsBoolFlag lets -name stand for -name=true.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func validate(v interface{}) error {
+	if _, err := govalidator.ValidateStruct(v); err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("config: %v", err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// collectFields returns the settable leaves of the struct rv. Nested structs
+// add a path segment unless they are inlined.
+func collectFields(rv reflect.Value, path []string) []field {
+	var fields []field
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+
+		name, inline := fieldKey(sf)
+		if name == "-" {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			sub := append(append([]string{}, path...), name)
+			if inline {
+				sub = path
+			}
+			fields = append(fields, collectFields(fv, sub)...)
+			continue
+		}
+		if !isSupported(fv.Type()) {
+			continue
+		}
+
+		fields = append(fields, field{
+			path:  append(append([]string{}, path...), name),
+			value: fv,
+			usage: sf.Tag.Get("usage"),
+		})
+	}
+	return fields
+}
+
+func fieldKey(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("yaml")
+	parts := strings.Split(tag, ",")
+	inline := false
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			inline = true
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], inline
+	}
+	return strings.ToLower(sf.Name), inline || sf.Anonymous
+}
+
+func isSupported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && isSupported(t.Elem())
+	}
+	return false
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var items []string
+		if s != "" {
+			items = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+)
+
+// Defaults of the Consul health check of a registered instance.
+const (
+	DefaultCheckInterval   = 10 * time.Second
+	DefaultDeregisterAfter = time.Minute
+)
+
+// NewConsul returns the discovery and registry of the services in Consul.
+func NewConsul(client *consul.Client, logger log.Factory) *Consul {
+	return &Consul{
+		client:          client,
+		logger:          logger,
+		builder:         grpc_resolver.NewConsulBuilder(client, logger),
+		checkInterval:   DefaultCheckInterval,
+		deregisterAfter: DefaultDeregisterAfter,
+		keepers:         make(map[string]func()),
+	}
+}
+
+// Consul finds the instances passing their health checks in Consul and
+// registers instances checked by the gRPC health service, or reporting
+// their health by a TTL heartbeat. A registered instance is registered
+// again when the agent loses it, e.g. after a restart.
+type Consul struct {
+	client          *consul.Client
+	logger          log.Factory
+	builder         *grpc_resolver.ConsulBuilder
+	tags            []string
+	checkInterval   time.Duration
+	deregisterAfter time.Duration
+	ttl             time.Duration
+	advertise       string
+	health          healthpb.HealthServer
+
+	mu      sync.Mutex
+	keepers map[string]func()
+}
+
+// WithTags resolves only the instances with all of tags.
+func (c *Consul) WithTags(tags ...string) *Consul {
+	c.tags = tags
+	return c
+}
+
+// WithCheck sets the interval of the health check of the registered
+// instances and how long a failing instance stays registered.
+func (c *Consul) WithCheck(interval, deregisterAfter time.Duration) *Consul {
+	c.checkInterval = interval
+	c.deregisterAfter = deregisterAfter
+	return c
+}
+
+// WithTTLCheck checks the registered instances by a heartbeat sent every
+// third of ttl instead of the gRPC health service, for the instances Consul
+// cannot reach.
+func (c *Consul) WithTTLCheck(ttl time.Duration) *Consul {
+	c.ttl = ttl
+	return c
+}
+
+// WithHealth sends the serving status of the instances reported by health as
+// their TTL heartbeat, critical unless SERVING. The heartbeat is always
+// passing without it.
+func (c *Consul) WithHealth(health healthpb.HealthServer) *Consul {
+	c.health = health
+	return c
+}
+
+// WithAdvertiseAddress registers the instances with address, an IPv4 or IPv6
+// address or a host name, instead of their own address.
+func (c *Consul) WithAdvertiseAddress(address string) *Consul {
+	c.advertise = address
+	return c
+}
+
+// Target implements Discovery
+func (c *Consul) Target(service string) string {
+	return grpc_resolver.ConsulTarget(service, c.tags...)
+}
+
+// Builder implements Discovery
+func (c *Consul) Builder() resolver.Builder {
+	return c.builder
+}
+
+// Register implements Registry. The instance is kept registered until
+// Deregister, even when the first registration fails.
+func (c *Consul) Register(instance Instance) error {
+	instance = c.Advertise(instance)
+	err := c.register(instance)
+	c.keep(instance)
+	return err
+}
+
+// Deregister implements Registry
+func (c *Consul) Deregister(instance Instance) error {
+	c.mu.Lock()
+	if stop, ok := c.keepers[instanceID(instance)]; ok {
+		delete(c.keepers, instanceID(instance))
+		stop()
+	}
+	c.mu.Unlock()
+	return c.client.Agent().ServiceDeregister(instanceID(instance))
+}
+
+// Watch implements Registry
+func (c *Consul) Watch(service string, update func(instances []Instance)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		c.builder.Watch(ctx, service, c.tags, func(entries []*consul.ServiceEntry) {
+			update(consulInstances(entries))
+		})
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// Advertise implements Advertiser
+func (c *Consul) Advertise(instance Instance) Instance {
+	if c.advertise != "" {
+		instance.Address = c.advertise
+	}
+	return instance
+}
+
+func (c *Consul) register(instance Instance) error {
+	check := &consul.AgentServiceCheck{
+		CheckID:                        checkID(instance),
+		DeregisterCriticalServiceAfter: c.deregisterAfter.String(),
+	}
+	if c.ttl > 0 {
+		check.TTL = c.ttl.String()
+	} else {
+		check.Interval = c.checkInterval.String()
+		check.GRPC = fmt.Sprintf("%v/%v", instance.Addr(), instance.Service)
+	}
+
+	err := c.client.Agent().ServiceRegister(&consul.AgentServiceRegistration{
+		ID:      instanceID(instance),
+		Name:    instance.Service,
+		Tags:    instance.Tags,
+		Meta:    instance.Meta,
+		Port:    instance.Port,
+		Address: instance.Address,
+		Check:   check,
+	})
+	if err != nil || c.ttl <= 0 {
+		return err
+	}
+	// a TTL check is critical until its first heartbeat
+	return c.heartbeat(instance)
+}
+
+// keep sends the heartbeats of instance, or verifies that the agent still
+// has it, and registers it again when needed.
+func (c *Consul) keep(instance Instance) {
+	interval := c.checkInterval
+	if c.ttl > 0 {
+		interval = c.ttl / 3
+	}
+	done := make(chan struct{})
+	var once sync.Once
+
+	c.mu.Lock()
+	if stop, ok := c.keepers[instanceID(instance)]; ok {
+		stop()
+	}
+	c.keepers[instanceID(instance)] = func() { once.Do(func() { close(done) }) }
+	c.mu.Unlock()
+
+	logger := c.logger.Bg().With(zap.String("id", instanceID(instance)))
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			err := c.check(instance)
+			if err == nil {
+				continue
+			}
+			select {
+			case <-done:
+				// deregistered meanwhile
+				return
+			default:
+			}
+			logger.Warn("Consul lost the registration", zap.Error(err))
+			if err := c.register(instance); err != nil {
+				logger.Error("Register consul service", zap.Error(err))
+				continue
+			}
+			logger.Info("Registered consul service again")
+		}
+	}()
+}
+
+// check sends the heartbeat of instance or verifies that the agent has it.
+func (c *Consul) check(instance Instance) error {
+	if c.ttl > 0 {
+		return c.heartbeat(instance)
+	}
+	services, err := c.client.Agent().Services()
+	if err != nil {
+		return err
+	}
+	if _, ok := services[instanceID(instance)]; !ok {
+		return fmt.Errorf("service %v is not registered", instanceID(instance))
+	}
+	return nil
+}
+
+// heartbeat updates the TTL check of instance with its serving status.
+func (c *Consul) heartbeat(instance Instance) error {
+	status, output := consul.HealthPassing, ""
+	if c.health != nil {
+		resp, err := c.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: instance.Service})
+		switch {
+		case err != nil:
+			status, output = consul.HealthCritical, err.Error()
+		case resp.Status != healthpb.HealthCheckResponse_SERVING:
+			status, output = consul.HealthCritical, resp.Status.String()
+		}
+	}
+	return c.client.Agent().UpdateTTL(checkID(instance), output, status)
+}
+
+func checkID(instance Instance) string {
+	return "service:" + instanceID(instance)
+}
+
+// consulInstances returns the instances of entries, at the service address
+// or else the node address.
+func consulInstances(entries []*consul.ServiceEntry) []Instance {
+	instances := make([]Instance, 0, len(entries))
+	for _, e := range entries {
+		address := e.Service.Address
+		if address == "" {
+			address = e.Node.Address
+		}
+		instances = append(instances, Instance{
+			ID:      e.Service.ID,
+			Service: e.Service.Service,
+			Address: address,
+			Port:    e.Service.Port,
+			Tags:    e.Service.Tags,
+			Meta:    e.Service.Meta,
+		})
+	}
+	return instances
+}
@@ -0,0 +1,197 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	grpc_health "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// fakeAgent serves the agent endpoints used to register services and the
+// health of the registered services.
+type fakeAgent struct {
+	mu        sync.Mutex
+	services  map[string]*consul.AgentServiceRegistration
+	index     uint64
+	registers int
+	statuses  map[string]string
+}
+
+// restart loses the registered services.
+func (a *fakeAgent) restart() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.services = make(map[string]*consul.AgentServiceRegistration)
+	a.index++
+}
+
+func (a *fakeAgent) registered(id string) (*consul.AgentServiceRegistration, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.services[id], a.registers
+}
+
+// status returns the status of the last heartbeat of id.
+func (a *fakeAgent) status(id string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.statuses[id]
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var reg consul.AgentServiceRegistration
+		json.NewDecoder(r.Body).Decode(&reg)
+		a.mu.Lock()
+		a.services[reg.ID] = &reg
+		a.registers++
+		a.index++
+		a.mu.Unlock()
+
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		a.mu.Lock()
+		delete(a.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+		a.index++
+		a.mu.Unlock()
+
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/"), "service:")
+		if reg, _ := a.registered(id); reg == nil {
+			http.Error(w, "unknown check", http.StatusInternalServerError)
+			return
+		}
+		var update struct{ Status string }
+		json.NewDecoder(r.Body).Decode(&update)
+		a.mu.Lock()
+		a.statuses[id] = update.Status
+		a.mu.Unlock()
+
+	case r.URL.Path == "/v1/agent/services":
+		a.mu.Lock()
+		services := make(map[string]*consul.AgentService)
+		for id, reg := range a.services {
+			services[id] = &consul.AgentService{ID: id, Service: reg.Name}
+		}
+		a.mu.Unlock()
+		json.NewEncoder(w).Encode(services)
+
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+		deadline := time.Now().Add(time.Second)
+		for {
+			a.mu.Lock()
+			if a.index > wait || time.Now().After(deadline) {
+				break
+			}
+			a.mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+		}
+		defer a.mu.Unlock()
+
+		var entries []*consul.ServiceEntry
+		for id, reg := range a.services {
+			entries = append(entries, &consul.ServiceEntry{
+				Node:    &consul.Node{Address: "10.0.0.1"},
+				Service: &consul.AgentService{ID: id, Service: reg.Name, Address: reg.Address, Port: reg.Port, Meta: reg.Meta},
+			})
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(a.index, 10))
+		json.NewEncoder(w).Encode(entries)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeAgent(t *testing.T) (*fakeAgent, *consul.Client) {
+	agent := &fakeAgent{
+		services: make(map[string]*consul.AgentServiceRegistration),
+		index:    1,
+		statuses: make(map[string]string),
+	}
+	srv := httptest.NewServer(agent)
+	t.Cleanup(srv.Close)
+
+	cfg := consul.DefaultConfig()
+	cfg.Address = strings.TrimPrefix(srv.URL, "http://")
+	client, err := consul.NewClient(cfg)
+	require.NoError(t, err)
+	return agent, client
+}
+
+func TestConsulRegistry(t *testing.T) {
+	agent, client := newFakeAgent(t)
+
+	c := NewConsul(client, log.NewFactory(zap.NewNop())).
+		WithTTLCheck(30 * time.Millisecond).
+		WithAdvertiseAddress("2001:db8::1")
+
+	updates := make(chan []Instance, 10)
+	stop := c.Watch("payment", func(instances []Instance) { updates <- instances })
+	defer stop()
+	require.Empty(t, <-updates)
+
+	instance := Instance{ID: "payment-1", Service: "payment", Address: "10.0.0.9", Port: 9000, Meta: map[string]string{"zone": "a"}}
+	require.NoError(t, c.Register(instance))
+	reg, _ := agent.registered("payment-1")
+	require.Equal(t, "2001:db8::1", reg.Address)
+	require.Equal(t, "30ms", reg.Check.TTL)
+	require.Empty(t, reg.Check.GRPC)
+	require.Equal(t, consul.HealthPassing, agent.status("payment-1"))
+
+	watched := <-updates
+	require.Len(t, watched, 1)
+	require.Equal(t, "[2001:db8::1]:9000", watched[0].Addr())
+	require.Equal(t, "a", watched[0].Meta["zone"])
+
+	// the heartbeat registers the instance again after the agent restarts
+	agent.restart()
+	require.Eventually(t, func() bool {
+		reg, registers := agent.registered("payment-1")
+		return reg != nil && registers == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, c.Deregister(instance))
+	time.Sleep(50 * time.Millisecond)
+	reg, registers := agent.registered("payment-1")
+	require.Nil(t, reg)
+	require.Equal(t, 2, registers)
+}
+
+func TestConsulRegistry_health(t *testing.T) {
+	agent, client := newFakeAgent(t)
+
+	health := grpc_health.NewServer()
+	health.SetServingStatus("payment", healthpb.HealthCheckResponse_NOT_SERVING)
+	c := NewConsul(client, log.NewFactory(zap.NewNop())).
+		WithTTLCheck(30 * time.Millisecond).
+		WithHealth(health)
+
+	instance := Instance{ID: "payment-1", Service: "payment", Address: "10.0.0.9", Port: 9000}
+	require.NoError(t, c.Register(instance))
+	defer c.Deregister(instance)
+	require.Equal(t, consul.HealthCritical, agent.status("payment-1"))
+
+	// the heartbeat follows the serving status
+	health.SetServingStatus("payment", healthpb.HealthCheckResponse_SERVING)
+	require.Eventually(t, func() bool {
+		return agent.status("payment-1") == consul.HealthPassing
+	}, time.Second, 10*time.Millisecond)
+
+	health.Shutdown()
+	require.Eventually(t, func() bool {
+		return agent.status("payment-1") == consul.HealthCritical
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,112 @@
+// Package discovery finds the instances of services for the dialer and
+// registers the instances of the local services. Consul is one
+// implementation; static address lists, DNS SRV records and a watched file
+// serve local development and CI, and an in-memory registry serves tests.
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
+)
+
+// Instance is an instance of a service.
+type Instance struct {
+	ID      string
+	Service string
+	Address string
+	Port    int
+	Tags    []string
+	// Meta is the service metadata, e.g. the grpc_resolver.Metadata read
+	// by the balancer
+	Meta map[string]string
+}
+
+// Addr returns the host:port of the instance.
+func (i Instance) Addr() string {
+	return net.JoinHostPort(i.Address, strconv.Itoa(i.Port))
+}
+
+// Discovery finds the instances of services for the dialer.
+type Discovery interface {
+	// Target returns the dial target of service.
+	Target(service string) string
+	// Builder returns the resolver of the targets.
+	Builder() resolver.Builder
+}
+
+// Registry registers the instances of the local services.
+type Registry interface {
+	Register(instance Instance) error
+	Deregister(instance Instance) error
+	// Watch pushes the registered instances of service to update until stop
+	// is called.
+	Watch(service string, update func(instances []Instance)) (stop func())
+}
+
+// Advertiser is implemented by the registries registering the instances at
+// another address than their own, e.g. the address of a NAT.
+type Advertiser interface {
+	// Advertise returns instance at its registered address.
+	Advertise(instance Instance) Instance
+}
+
+// InstanceID returns the default ID of an instance, made of its service and
+// registered address.
+func InstanceID(instance Instance) string {
+	return fmt.Sprintf("%v-%v-%v", instance.Service, instance.Address, instance.Port)
+}
+
+// serviceConfig balances the calls over the resolved addresses.
+const serviceConfig = `{"loadBalancingPolicy":"round_robin"}`
+
+// source pushes the instances of a service to update until stop is called.
+// It reports to fail the errors before the first update.
+type source interface {
+	watch(service string, update func(instances []Instance), fail func(err error)) (stop func())
+}
+
+// builder builds the resolvers of the targets scheme:///service from a
+// source.
+type builder struct {
+	scheme string
+	source source
+}
+
+func (b *builder) Scheme() string {
+	return b.scheme
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	var sc *serviceconfig.ParseResult
+	if !opts.DisableServiceConfig {
+		sc = cc.ParseServiceConfig(serviceConfig)
+	}
+
+	stop := b.source.watch(target.Endpoint, func(instances []Instance) {
+		addrs := make([]resolver.Address, 0, len(instances))
+		for _, instance := range instances {
+			addrs = append(addrs, resolver.Address{
+				Addr:     instance.Addr(),
+				Metadata: grpc_resolver.ParseMetadata(instance.Meta),
+			})
+		}
+		cc.UpdateState(resolver.State{Addresses: addrs, ServiceConfig: sc})
+	}, cc.ReportError)
+	return &sourceResolver{stop: stop}, nil
+}
+
+type sourceResolver struct {
+	stop func()
+}
+
+func (r *sourceResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *sourceResolver) Close() {
+	r.stop()
+}
@@ -0,0 +1,174 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// fakeClientConn records the addresses pushed by a resolver.
+type fakeClientConn struct {
+	resolver.ClientConn
+
+	addrs  chan []string
+	metas  chan []interface{}
+	errors chan error
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{addrs: make(chan []string, 10), metas: make(chan []interface{}, 10), errors: make(chan error, 10)}
+}
+
+func (cc *fakeClientConn) UpdateState(state resolver.State) {
+	var (
+		addrs []string
+		metas []interface{}
+	)
+	for _, a := range state.Addresses {
+		addrs = append(addrs, a.Addr)
+		metas = append(metas, a.Metadata)
+	}
+	cc.addrs <- addrs
+	cc.metas <- metas
+}
+
+func (cc *fakeClientConn) ReportError(err error) {
+	cc.errors <- err
+}
+
+func (cc *fakeClientConn) ParseServiceConfig(serviceConfigJSON string) *serviceconfig.ParseResult {
+	return &serviceconfig.ParseResult{}
+}
+
+func build(t *testing.T, d Discovery, service string) (*fakeClientConn, resolver.Resolver) {
+	cc := newFakeClientConn()
+	r, err := d.Builder().Build(resolver.Target{Scheme: d.Builder().Scheme(), Endpoint: service}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	return cc, r
+}
+
+func TestStatic(t *testing.T) {
+	cc, r := build(t, NewStatic(map[string][]string{"payment": {"10.0.0.1:9000", "invalid"}}), "payment")
+	defer r.Close()
+	require.Equal(t, []string{"10.0.0.1:9000"}, <-cc.addrs)
+
+	t.Run("Unknown", func(t *testing.T) {
+		cc, r := build(t, NewStatic(map[string][]string{"payment": {"10.0.0.1:9000"}}), "billing")
+		defer r.Close()
+		require.Error(t, <-cc.errors)
+		require.Len(t, cc.addrs, 0)
+	})
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("payment:\n  - 10.0.0.1:9000\n"), 0644))
+
+	f := NewFile(path, log.NewFactory(zap.NewNop())).WithInterval(10 * time.Millisecond)
+	cc, r := build(t, f, "payment")
+	defer r.Close()
+	require.Equal(t, []string{"10.0.0.1:9000"}, <-cc.addrs)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"payment": ["10.0.0.2:9000", "10.0.0.3:9000"]}`), 0644))
+	require.Equal(t, []string{"10.0.0.2:9000", "10.0.0.3:9000"}, <-cc.addrs)
+
+	require.NoError(t, os.Remove(path))
+	time.Sleep(50 * time.Millisecond)
+	require.Len(t, cc.addrs, 0, "the last addresses are kept")
+	require.Len(t, cc.errors, 0)
+
+	t.Run("Missing", func(t *testing.T) {
+		f := NewFile(filepath.Join(dir, "missing.yaml"), log.NewFactory(zap.NewNop())).WithInterval(10 * time.Millisecond)
+		cc, r := build(t, f, "payment")
+		defer r.Close()
+		require.Error(t, <-cc.errors, "reported until the file is read")
+	})
+}
+
+func TestDNS(t *testing.T) {
+	d := NewDNS("svc.local", log.NewFactory(zap.NewNop()))
+	var looked string
+	d.lookup = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		looked = "_" + service + "._" + proto + "." + name
+		return "", []*net.SRV{{Target: "b.svc.local.", Port: 9000}, {Target: "a.svc.local.", Port: 9000}}, nil
+	}
+
+	cc, r := build(t, d, "payment")
+	defer r.Close()
+	require.Equal(t, []string{"a.svc.local:9000", "b.svc.local:9000"}, <-cc.addrs)
+	require.Equal(t, "_grpc._tcp.payment.svc.local", looked)
+	require.Equal(t, []interface{}{grpc_resolver.Metadata{Weight: 1}, grpc_resolver.Metadata{Weight: 1}}, <-cc.metas)
+
+	t.Run("Priority and weight", func(t *testing.T) {
+		d := NewDNS("", log.NewFactory(zap.NewNop()))
+		d.lookup = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			return "", []*net.SRV{
+				{Target: "a", Port: 9000, Priority: 10, Weight: 3},
+				{Target: "b", Port: 9000, Priority: 10, Weight: 1},
+				{Target: "backup", Port: 9000, Priority: 20, Weight: 1},
+			}, nil
+		}
+
+		cc, r := build(t, d, "payment")
+		defer r.Close()
+		require.Equal(t, []string{"a:9000", "b:9000"}, <-cc.addrs, "the lowest priority only")
+		require.Equal(t, []interface{}{grpc_resolver.Metadata{Weight: 3}, grpc_resolver.Metadata{Weight: 1}}, <-cc.metas)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		d := NewDNS("", log.NewFactory(zap.NewNop()))
+		d.lookup = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			return "", nil, &net.DNSError{Err: "no such host", Name: name}
+		}
+
+		cc, r := build(t, d, "payment")
+		defer r.Close()
+		require.Error(t, <-cc.errors, "reported until the records are resolved")
+	})
+}
+
+func TestMemory(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	m := NewMemory()
+	instance := Instance{Service: "health", Address: "127.0.0.1", Port: lis.Addr().(*net.TCPAddr).Port}
+	require.NoError(t, m.Register(instance))
+
+	conn, err := grpc.Dial(m.Target("health"), grpc.WithInsecure(), grpc.WithResolvers(m.Builder()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+
+	cc, r := build(t, m, "health")
+	defer r.Close()
+	require.Equal(t, []string{instance.Addr()}, <-cc.addrs)
+	require.NoError(t, m.Deregister(instance))
+	require.Empty(t, <-cc.addrs)
+	require.Empty(t, m.Instances("health"))
+}
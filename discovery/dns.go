@@ -0,0 +1,160 @@
+package discovery
+
+import (
+	"context"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/resolver"
+
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+)
+
+// DNSScheme is the scheme of the targets of a DNS discovery.
+const DNSScheme = "dnssrv"
+
+// DefaultDNSInterval is how often the SRV records are looked up.
+const DefaultDNSInterval = 30 * time.Second
+
+// NewDNS returns a discovery looking up the SRV records _grpc._tcp.service
+// in domain, e.g. _grpc._tcp.payment.svc.cluster.local for the domain
+// svc.cluster.local. An empty domain uses the service name as is.
+//
+// Only the records of the lowest priority are resolved, the others serve
+// once they are the lowest. The weights of the records are the weights of
+// the instances, balanced by the zone weighted balancer, see
+// dialer.WithBalancer; round robin ignores them.
+func NewDNS(domain string, logger log.Factory) *DNS {
+	d := &DNS{
+		domain:   domain,
+		logger:   logger,
+		interval: DefaultDNSInterval,
+		lookup:   net.DefaultResolver.LookupSRV,
+	}
+	d.builder = &builder{scheme: DNSScheme, source: d}
+	return d
+}
+
+// DNS resolves services through DNS SRV records.
+type DNS struct {
+	domain   string
+	logger   log.Factory
+	interval time.Duration
+	builder  *builder
+	lookup   func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// WithInterval ...
+func (d *DNS) WithInterval(interval time.Duration) *DNS {
+	d.interval = interval
+	return d
+}
+
+// Target implements Discovery
+func (d *DNS) Target(service string) string {
+	return DNSScheme + ":///" + service
+}
+
+// Builder implements Discovery
+func (d *DNS) Builder() resolver.Builder {
+	return d.builder
+}
+
+func (d *DNS) resolve(ctx context.Context, service string) ([]Instance, error) {
+	name := service
+	if d.domain != "" {
+		name = service + "." + strings.TrimPrefix(d.domain, ".")
+	}
+	_, records, err := d.lookup(ctx, "grpc", "tcp", name)
+	if err != nil {
+		return nil, err
+	}
+
+	// all zero weights are equal
+	priority, weighted := uint16(math.MaxUint16), false
+	for _, r := range records {
+		if r.Priority < priority {
+			priority = r.Priority
+		}
+		weighted = weighted || r.Weight > 0
+	}
+
+	instances := make([]Instance, 0, len(records))
+	for _, r := range records {
+		if r.Priority != priority {
+			continue
+		}
+		instance := Instance{
+			Service: service,
+			Address: strings.TrimSuffix(r.Target, "."),
+			Port:    int(r.Port),
+		}
+		instance.ID = instance.Addr()
+		if weighted {
+			instance.Meta = map[string]string{grpc_resolver.MetaWeight: strconv.Itoa(int(r.Weight))}
+		}
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Addr() < instances[j].Addr() })
+	return instances, nil
+}
+
+func (d *DNS) watch(service string, update func(instances []Instance), fail func(err error)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		var last []Instance
+		for {
+			instances, err := d.resolve(ctx, service)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				// the last addresses are kept
+				d.logger.Bg().Error("Lookup SRV records", zap.String("service", service), zap.Error(err))
+				if last == nil {
+					fail(err)
+				}
+			} else if last == nil || !sameInstances(last, instances) {
+				last = instances
+				update(instances)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func sameInstances(a, b []Instance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Addr() != b[i].Addr() || a[i].Meta[grpc_resolver.MetaWeight] != b[i].Meta[grpc_resolver.MetaWeight] {
+			return false
+		}
+	}
+	return true
+}
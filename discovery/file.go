@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/resolver"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+)
+
+// FileScheme is the scheme of the targets of a File discovery.
+const FileScheme = "file"
+
+// DefaultFileInterval is how often the file is read for changes.
+const DefaultFileInterval = 2 * time.Second
+
+// NewFile returns a discovery reading the addresses of the services from a
+// YAML or JSON file, re-read when it changes:
+//
+//	payment:
+//	  - 127.0.0.1:9000
+//	  - 127.0.0.1:9001
+//	wallet:
+//	  - 127.0.0.1:9100
+func NewFile(path string, logger log.Factory) *File {
+	f := &File{path: path, logger: logger, interval: DefaultFileInterval}
+	f.builder = &builder{scheme: FileScheme, source: f}
+	return f
+}
+
+// File resolves services to the addresses listed in a file.
+type File struct {
+	path     string
+	logger   log.Factory
+	interval time.Duration
+	builder  *builder
+}
+
+// WithInterval ...
+func (f *File) WithInterval(interval time.Duration) *File {
+	f.interval = interval
+	return f
+}
+
+// Target implements Discovery
+func (f *File) Target(service string) string {
+	return FileScheme + ":///" + service
+}
+
+// Builder implements Discovery
+func (f *File) Builder() resolver.Builder {
+	return f.builder
+}
+
+// read returns the content of the file and its addresses per service.
+func (f *File) read() ([]byte, map[string][]string, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var services map[string][]string
+	if err := yaml.Unmarshal(data, &services); err != nil {
+		return data, nil, err
+	}
+	return data, services, nil
+}
+
+func (f *File) watch(service string, update func(instances []Instance), fail func(err error)) func() {
+	done := make(chan struct{})
+	var once sync.Once
+
+	var (
+		last    []byte
+		lastErr string
+	)
+	poll := func() {
+		data, services, err := f.read()
+		if err != nil {
+			// the last addresses are kept, the error is logged once
+			if err.Error() != lastErr {
+				f.logger.Bg().Error("Read discovery file", zap.String("path", f.path), zap.Error(err))
+			}
+			lastErr = err.Error()
+			if last == nil {
+				// the connection waits for addresses until then
+				fail(err)
+			}
+			return
+		}
+		lastErr = ""
+		if last != nil && bytes.Equal(data, last) {
+			return
+		}
+		last = data
+		update(parseAddrs(service, services[service]))
+	}
+
+	poll()
+	go func() {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				poll()
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,134 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// MemoryScheme is the scheme of the targets of a Memory registry.
+const MemoryScheme = "memory"
+
+// NewMemory returns an in-memory registry, which is also the discovery of
+// the instances registered in it. It lets tests register a GRPCServer and
+// dial it by name.
+func NewMemory() *Memory {
+	m := &Memory{
+		instances: make(map[string]map[string]Instance),
+		watchers:  make(map[string]map[int]func([]Instance)),
+	}
+	m.builder = &builder{scheme: MemoryScheme, source: m}
+	return m
+}
+
+// Memory keeps the registered instances in memory.
+type Memory struct {
+	builder *builder
+
+	// notifyMu serializes the updates pushed to the watchers
+	notifyMu  sync.Mutex
+	mu        sync.Mutex
+	instances map[string]map[string]Instance
+	watchers  map[string]map[int]func([]Instance)
+	nextID    int
+}
+
+// Register implements Registry
+func (m *Memory) Register(instance Instance) error {
+	m.update(instance.Service, func() {
+		if m.instances[instance.Service] == nil {
+			m.instances[instance.Service] = make(map[string]Instance)
+		}
+		m.instances[instance.Service][instanceID(instance)] = instance
+	})
+	return nil
+}
+
+// Deregister implements Registry
+func (m *Memory) Deregister(instance Instance) error {
+	m.update(instance.Service, func() {
+		delete(m.instances[instance.Service], instanceID(instance))
+	})
+	return nil
+}
+
+// Instances returns the instances of service.
+func (m *Memory) Instances(service string) []Instance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(service)
+}
+
+// Target implements Discovery
+func (m *Memory) Target(service string) string {
+	return MemoryScheme + ":///" + service
+}
+
+// Builder implements Discovery
+func (m *Memory) Builder() resolver.Builder {
+	return m.builder
+}
+
+// Watch implements Registry
+func (m *Memory) Watch(service string, update func(instances []Instance)) func() {
+	return m.watch(service, update, nil)
+}
+
+func (m *Memory) watch(service string, update func(instances []Instance), _ func(error)) func() {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	if m.watchers[service] == nil {
+		m.watchers[service] = make(map[int]func([]Instance))
+	}
+	m.watchers[service][id] = update
+	instances := m.list(service)
+	m.mu.Unlock()
+
+	update(instances)
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.watchers[service], id)
+	}
+}
+
+// update applies change to the instances of service and pushes them to its
+// watchers.
+func (m *Memory) update(service string, change func()) {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+
+	m.mu.Lock()
+	change()
+	instances := m.list(service)
+	watchers := make([]func([]Instance), 0, len(m.watchers[service]))
+	for _, watcher := range m.watchers[service] {
+		watchers = append(watchers, watcher)
+	}
+	m.mu.Unlock()
+
+	for _, watcher := range watchers {
+		watcher(instances)
+	}
+}
+
+func (m *Memory) list(service string) []Instance {
+	instances := make([]Instance, 0, len(m.instances[service]))
+	for _, instance := range m.instances[service] {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Addr() < instances[j].Addr() })
+	return instances
+}
+
+func instanceID(instance Instance) string {
+	if instance.ID != "" {
+		return instance.ID
+	}
+	return instance.Addr()
+}
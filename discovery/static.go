@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// StaticScheme is the scheme of the targets of a Static discovery.
+const StaticScheme = "static"
+
+// NewStatic returns a discovery of fixed addresses, host:port, per service.
+func NewStatic(services map[string][]string) *Static {
+	s := &Static{services: services}
+	s.builder = &builder{scheme: StaticScheme, source: s}
+	return s
+}
+
+// Static resolves services to fixed addresses.
+type Static struct {
+	services map[string][]string
+	builder  *builder
+}
+
+// Target implements Discovery
+func (s *Static) Target(service string) string {
+	return StaticScheme + ":///" + service
+}
+
+// Builder implements Discovery
+func (s *Static) Builder() resolver.Builder {
+	return s.builder
+}
+
+// watch reports an error for a service that is not configured.
+func (s *Static) watch(service string, update func(instances []Instance), fail func(error)) func() {
+	addrs, ok := s.services[service]
+	if !ok {
+		fail(fmt.Errorf("static discovery: service %q is not configured", service))
+		return func() {}
+	}
+	update(parseAddrs(service, addrs))
+	return func() {}
+}
+
+// parseAddrs returns the instances at addrs, skipping the invalid ones.
+func parseAddrs(service string, addrs []string) []Instance {
+	instances := make([]Instance, 0, len(addrs))
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+		instances = append(instances, Instance{ID: addr, Service: service, Address: host, Port: p})
+	}
+	return instances
+}
@@ -0,0 +1,117 @@
+package dynconfig
+
+import (
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/hystrixconfig"
+	"github.com/richard-xtek/go-grpc-micro-kit/ratelimit"
+)
+
+// FeatureHystrix is the feature flag enabling hystrix in the client
+// interceptors of the dialer. When present it overrides
+// dialer.HystrixEnableFlag, on or off; when absent the flag applies.
+const FeatureHystrix = "hystrix"
+
+// Settings is the runtime configuration of a service, stored as YAML or JSON
+// under a Consul KV key:
+//
+//	log_level: debug
+//	features:
+//	  hystrix: true
+//	hystrix:
+//	  default:
+//	    timeout: 1000
+//	  /payment.Payment/Pay:
+//	    timeout: 5000
+//	rate_limits:
+//	  default:
+//	    rate: 1000
+//	    burst: 100
+//	  /payment.Payment/Pay:
+//	    rate: 100
+//	    burst: 20
+type Settings struct {
+	LogLevel   string                    `yaml:"log_level" json:"log_level"`
+	Features   map[string]bool           `yaml:"features" json:"features"`
+	Hystrix    map[string]HystrixCommand `yaml:"hystrix" json:"hystrix"`
+	RateLimits map[string]RateLimit      `yaml:"rate_limits" json:"rate_limits"`
+}
+
+// Feature reports whether the named feature flag is on.
+func (s Settings) Feature(name string) bool {
+	return s.Features[name]
+}
+
+// HystrixCommand overrides the fields of a hystrix command config. Zero
+// fields keep the built-in defaults. The "default" command applies to the
+// commands without their own config.
+type HystrixCommand struct {
+	Timeout                int `yaml:"timeout" json:"timeout"`
+	MaxConcurrentRequests  int `yaml:"max_concurrent_requests" json:"max_concurrent_requests"`
+	RequestVolumeThreshold int `yaml:"request_volume_threshold" json:"request_volume_threshold"`
+	SleepWindow            int `yaml:"sleep_window" json:"sleep_window"`
+	ErrorPercentThreshold  int `yaml:"error_percent_threshold" json:"error_percent_threshold"`
+}
+
+// DefaultHystrixCommand is the key of the default hystrix command config.
+const DefaultHystrixCommand = "default"
+
+// merge applies the non zero fields of c over base.
+func (c HystrixCommand) merge(base hystrix.CommandConfig) hystrix.CommandConfig {
+	if c.Timeout != 0 {
+		base.Timeout = c.Timeout
+	}
+	if c.MaxConcurrentRequests != 0 {
+		base.MaxConcurrentRequests = c.MaxConcurrentRequests
+	}
+	if c.RequestVolumeThreshold != 0 {
+		base.RequestVolumeThreshold = c.RequestVolumeThreshold
+	}
+	if c.SleepWindow != 0 {
+		base.SleepWindow = c.SleepWindow
+	}
+	if c.ErrorPercentThreshold != 0 {
+		base.ErrorPercentThreshold = c.ErrorPercentThreshold
+	}
+	return base
+}
+
+// RateLimit allows Rate requests per second with bursts of Burst requests.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" json:"rate"`
+	Burst int     `yaml:"burst" json:"burst"`
+}
+
+// rateLimits returns the rate limits in the form of the ratelimit package.
+func (s Settings) rateLimits() map[string]ratelimit.Limit {
+	limits := make(map[string]ratelimit.Limit, len(s.RateLimits))
+	for method, l := range s.RateLimits {
+		limits[method] = ratelimit.Limit{Rate: l.Rate, Burst: l.Burst}
+	}
+	return limits
+}
+
+// applyHystrix pushes the hystrix settings to hystrixconfig.
+func applyHystrix(s Settings) {
+	if enabled, ok := s.Features[FeatureHystrix]; ok {
+		hystrixconfig.SetEnabled(enabled)
+	} else {
+		hystrixconfig.ResetEnabled()
+	}
+
+	base := builtinHystrixConfig
+	if c, ok := s.Hystrix[DefaultHystrixCommand]; ok {
+		base = c.merge(base)
+	}
+	hystrixconfig.SetDefaultConfig(base)
+
+	configs := make(map[string]hystrix.CommandConfig, len(s.Hystrix))
+	for name, c := range s.Hystrix {
+		if name != DefaultHystrixCommand {
+			configs[name] = c.merge(base)
+		}
+	}
+	hystrixconfig.SetCommandConfigs(configs)
+}
+
+// builtinHystrixConfig is the default before any runtime change.
+var builtinHystrixConfig = hystrixconfig.HystrixConfig()
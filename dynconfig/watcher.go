@@ -0,0 +1,269 @@
+// Package dynconfig watches the runtime configuration of a service in Consul
+// KV and pushes it to subscribers, so hystrix settings, the log level,
+// feature flags and rate limits change without a restart.
+package dynconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/ratelimit"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultWaitTime bounds a blocking query on the Consul key.
+	DefaultWaitTime = 5 * time.Minute
+	// DefaultRetryInterval is how long the watcher waits after a Consul error.
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// Subscriber receives the settings on every change.
+type Subscriber func(settings Settings)
+
+// NewWatcher returns a watcher of key, using a client such as the one
+// returned by registry.NewClient.
+func NewWatcher(client *consul.Client, key string, logger log.Factory) *Watcher {
+	return &Watcher{
+		client:        client,
+		key:           key,
+		logger:        logger,
+		waitTime:      DefaultWaitTime,
+		retryInterval: DefaultRetryInterval,
+	}
+}
+
+// Watcher watches a Consul KV key holding YAML or JSON Settings.
+type Watcher struct {
+	client *consul.Client
+	key    string
+	logger log.Factory
+
+	fallbackFile  string
+	waitTime      time.Duration
+	retryInterval time.Duration
+
+	mu          sync.RWMutex
+	settings    Settings
+	loaded      bool
+	index       uint64
+	subscribers []Subscriber
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// WithFallbackFile loads the settings from path when Consul is unreachable at
+// start. The file is rewritten with every value read from Consul, so it holds
+// the last known settings.
+func (w *Watcher) WithFallbackFile(path string) *Watcher {
+	w.fallbackFile = path
+	return w
+}
+
+// WithWaitTime ...
+func (w *Watcher) WithWaitTime(waitTime time.Duration) *Watcher {
+	w.waitTime = waitTime
+	return w
+}
+
+// WithRetryInterval ...
+func (w *Watcher) WithRetryInterval(interval time.Duration) *Watcher {
+	w.retryInterval = interval
+	return w
+}
+
+// Subscribe registers fn. It is called with the current settings if they are
+// loaded, then on every change.
+func (w *Watcher) Subscribe(fn Subscriber) *Watcher {
+	w.mu.Lock()
+	w.subscribers = append(w.subscribers, fn)
+	settings, loaded := w.settings, w.loaded
+	w.mu.Unlock()
+
+	if loaded {
+		fn(settings)
+	}
+	return w
+}
+
+// WithHystrix applies the hystrix settings and the hystrix feature flag.
+func (w *Watcher) WithHystrix() *Watcher {
+	return w.Subscribe(applyHystrix)
+}
+
+// WithRateLimits applies the rate limits to limits.
+func (w *Watcher) WithRateLimits(limits *ratelimit.Limits) *Watcher {
+	return w.Subscribe(func(s Settings) {
+		limits.Update(s.rateLimits())
+	})
+}
+
+// WithLogLevel applies the log level to logger.
+func (w *Watcher) WithLogLevel(logger log.Factory) *Watcher {
+	return w.Subscribe(func(s Settings) {
+		if s.LogLevel == "" || !logger.IsLevelAdjustable() {
+			return
+		}
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(s.LogLevel)); err != nil {
+			w.logger.Bg().Error("Invalid log level", zap.String("level", s.LogLevel), zap.Error(err))
+			return
+		}
+		if level != logger.LogLevel() {
+			logger.EnableLevel(level)
+			w.logger.Bg().Warn("Log level changed to " + level.String())
+		}
+	})
+}
+
+// Settings returns the current settings.
+func (w *Watcher) Settings() Settings {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.settings
+}
+
+// Feature reports whether the named feature flag is on.
+func (w *Watcher) Feature(name string) bool {
+	return w.Settings().Feature(name)
+}
+
+// Start loads the settings, from Consul or else from the fallback file, and
+// watches the key until Stop. It fails when neither source is available.
+func (w *Watcher) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if err := w.fetch(ctx, 0); err != nil {
+		w.logger.Bg().Warn("Read dynamic config from consul", zap.String("key", w.key), zap.Error(err))
+		if err := w.loadFallback(); err != nil {
+			cancel()
+			return err
+		}
+	}
+
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go w.watch(ctx)
+
+	return nil
+}
+
+// Stop stops watching.
+func (w *Watcher) Stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+	w.cancel = nil
+}
+
+func (w *Watcher) watch(ctx context.Context) {
+	defer close(w.done)
+
+	for {
+		w.mu.RLock()
+		index := w.index
+		w.mu.RUnlock()
+
+		err := w.fetch(ctx, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			w.logger.Bg().Warn("Watch dynamic config", zap.String("key", w.key), zap.Error(err))
+			select {
+			case <-time.After(w.retryInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// fetch reads the key, blocking until it changes past index when index is
+// not zero, and applies it.
+func (w *Watcher) fetch(ctx context.Context, index uint64) error {
+	opts := (&consul.QueryOptions{WaitIndex: index, WaitTime: w.waitTime}).WithContext(ctx)
+	pair, meta, err := w.client.KV().Get(w.key, opts)
+	if err != nil {
+		return err
+	}
+
+	newIndex := meta.LastIndex
+	if newIndex < index {
+		// the index went backwards, e.g. Consul was restored: start over
+		newIndex = 0
+	}
+	if pair == nil {
+		w.mu.Lock()
+		w.index = newIndex
+		w.mu.Unlock()
+		return fmt.Errorf("key %s not found", w.key)
+	}
+	if index != 0 && pair.ModifyIndex <= index {
+		w.mu.Lock()
+		w.index = newIndex
+		w.mu.Unlock()
+		return nil
+	}
+
+	if err := w.apply(pair.Value, newIndex); err != nil {
+		return err
+	}
+	if w.fallbackFile != "" {
+		if err := ioutil.WriteFile(w.fallbackFile, pair.Value, 0644); err != nil {
+			w.logger.Bg().Warn("Write dynamic config fallback file", zap.String("file", w.fallbackFile), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) loadFallback() error {
+	if w.fallbackFile == "" {
+		return errors.New("dynconfig: consul unreachable and no fallback file")
+	}
+	data, err := ioutil.ReadFile(w.fallbackFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("dynconfig: consul unreachable and fallback file %s does not exist", w.fallbackFile)
+		}
+		return err
+	}
+	w.logger.Bg().Warn("Dynamic config loaded from fallback file " + w.fallbackFile)
+	return w.apply(data, 0)
+}
+
+// apply parses data, stores the settings and notifies the subscribers.
+func (w *Watcher) apply(data []byte, index uint64) error {
+	var settings Settings
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		w.mu.Lock()
+		w.index = index
+		w.mu.Unlock()
+		return fmt.Errorf("dynconfig: parse %s: %v", w.key, err)
+	}
+
+	w.mu.Lock()
+	w.settings = settings
+	w.loaded = true
+	w.index = index
+	subscribers := append([]Subscriber{}, w.subscribers...)
+	w.mu.Unlock()
+
+	w.logger.Bg().Info("Dynamic config updated", zap.String("key", w.key), zap.Uint64("index", index))
+	for _, fn := range subscribers {
+		fn(settings)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package dynconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/hystrixconfig"
+	"github.com/richard-xtek/go-grpc-micro-kit/registry"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeKV serves a single Consul KV key with blocking queries.
+type fakeKV struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	value   []byte
+	index   uint64
+	healthy bool
+}
+
+func newFakeKV(value string) *fakeKV {
+	kv := &fakeKV{value: []byte(value), index: 1, healthy: true}
+	kv.cond = sync.NewCond(&kv.mu)
+	return kv
+}
+
+func (kv *fakeKV) set(value string) {
+	kv.mu.Lock()
+	kv.value = []byte(value)
+	kv.index++
+	kv.mu.Unlock()
+	kv.cond.Broadcast()
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if !kv.healthy {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	deadline := time.Now().Add(time.Second)
+	for wait != 0 && kv.index <= wait && time.Now().Before(deadline) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			kv.cond.Broadcast()
+		}()
+		kv.cond.Wait()
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(kv.index, 10))
+	json.NewEncoder(w).Encode([]*consul.KVPair{{
+		Key:         "service/payment",
+		Value:       kv.value,
+		ModifyIndex: kv.index,
+	}})
+}
+
+func TestWatcher(t *testing.T) {
+	kv := newFakeKV("log_level: info\nfeatures:\n  hystrix: true\nhystrix:\n  /a/b:\n    timeout: 100\n")
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "dynconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fallback := filepath.Join(dir, "settings.yaml")
+
+	client, err := registry.NewClient(srv.URL)
+	require.NoError(t, err)
+
+	logger := log.NewDevelopFactory("test")
+	updates := make(chan Settings, 10)
+	w := NewWatcher(client, "service/payment", log.NewFactory(zap.NewNop())).
+		WithFallbackFile(fallback).
+		WithHystrix().
+		WithLogLevel(logger).
+		Subscribe(func(s Settings) { updates <- s })
+	require.NoError(t, w.Start())
+	defer w.Stop()
+	defer hystrixconfig.ResetEnabled()
+
+	require.Equal(t, "info", (<-updates).LogLevel)
+	require.True(t, hystrixconfig.Enabled())
+	require.Equal(t, 100, hystrixconfig.CommandConfig("/a/b").Timeout)
+	require.Equal(t, builtinHystrixConfig.Timeout, hystrixconfig.CommandConfig("/c/d").Timeout)
+
+	kv.set(`{"log_level": "debug", "features": {"beta": true}, "rate_limits": {"/a/b": {"rate": 10, "burst": 5}}}`)
+	select {
+	case s := <-updates:
+		require.Equal(t, "debug", s.LogLevel)
+		require.Equal(t, RateLimit{Rate: 10, Burst: 5}, s.RateLimits["/a/b"])
+	case <-time.After(3 * time.Second):
+		t.Fatal("no update")
+	}
+	require.Equal(t, "debug", logger.LogLevel().String())
+	require.True(t, w.Feature("beta"))
+	require.False(t, hystrixconfig.Enabled())
+	require.True(t, hystrixconfig.EnabledOr(true), "the process flag applies without the feature")
+
+	kv.set(`{"log_level": "debug", "features": {"beta": true, "hystrix": false}}`)
+	select {
+	case <-updates:
+	case <-time.After(3 * time.Second):
+		t.Fatal("no update")
+	}
+	require.False(t, hystrixconfig.EnabledOr(true), "the feature overrides the process flag")
+
+	data, err := ioutil.ReadFile(fallback)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "debug")
+
+	// Consul down: the next watcher starts from the fallback file
+	kv.mu.Lock()
+	kv.healthy = false
+	kv.mu.Unlock()
+
+	w2 := NewWatcher(client, "service/payment", log.NewFactory(zap.NewNop())).
+		WithFallbackFile(fallback).
+		WithRetryInterval(10 * time.Millisecond)
+	require.NoError(t, w2.Start())
+	defer w2.Stop()
+	require.True(t, w2.Feature("beta"))
+
+	w3 := NewWatcher(client, "service/payment", log.NewFactory(zap.NewNop()))
+	require.Error(t, w3.Start())
+}
@@ -0,0 +1,294 @@
+// Package grpc_balancer balances the calls of a client over the instances of
+// a service using their grpc_resolver.Metadata: instances in the zone of the
+// client are preferred, instances are picked in proportion to their weight,
+// and canary instances receive a percentage of the calls or the calls asking
+// for them. The calls of a context made WithDistinctInstances avoid the
+// instances already picked for it.
+package grpc_balancer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/serviceconfig"
+
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
+)
+
+// Name is the name of the balancer in the service config.
+const Name = "zone_weighted"
+
+// Outgoing metadata keys routing a call to the canary instances, or to the
+// instances of a version.
+const (
+	CanaryHeader  = "x-canary"
+	VersionHeader = "x-version"
+)
+
+func init() {
+	balancer.Register(zoneBuilder{})
+}
+
+// Config configures the balancer of a client.
+type Config struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// Zone is the zone of the client.
+	Zone string `json:"zone,omitempty"`
+	// CanaryPercent is the percentage of the calls sent to the canary
+	// instances, from 0 to 100.
+	CanaryPercent float64 `json:"canaryPercent,omitempty"`
+}
+
+// ServiceConfig returns the service config balancing the calls with config,
+// given to grpc.WithDefaultServiceConfig.
+func ServiceConfig(config Config) string {
+	js, _ := json.Marshal(map[string][]map[string]Config{
+		"loadBalancingConfig": {{Name: config}},
+	})
+	return string(js)
+}
+
+// WithCanary routes the calls made with ctx to the canary instances.
+func WithCanary(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, CanaryHeader, "true")
+}
+
+// WithVersion routes the calls made with ctx to the instances of version.
+func WithVersion(ctx context.Context, version string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, VersionHeader, version)
+}
+
+type picksKey struct{}
+
+// picks are the instances picked for the calls of a context.
+type picks struct {
+	mu    sync.Mutex
+	addrs map[string]bool
+}
+
+// WithDistinctInstances sends the calls made with the returned context to
+// distinct instances while some candidates are not picked yet, e.g. the
+// hedged copies of a call.
+func WithDistinctInstances(ctx context.Context) context.Context {
+	return context.WithValue(ctx, picksKey{}, &picks{addrs: make(map[string]bool)})
+}
+
+// unpicked returns the endpoints of positive weight not picked yet, or all of
+// them when none is.
+func (p *picks) unpicked(endpoints []endpoint) []endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var unpicked []endpoint
+	for _, e := range endpoints {
+		if !p.addrs[e.addr] && e.md.Weight > 0 {
+			unpicked = append(unpicked, e)
+		}
+	}
+	if len(unpicked) == 0 {
+		return endpoints
+	}
+	return unpicked
+}
+
+func (p *picks) add(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addrs[addr] = true
+}
+
+type zoneBuilder struct{}
+
+func (zoneBuilder) Name() string {
+	return Name
+}
+
+func (zoneBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &pickerBuilder{}
+	b := base.NewBalancerBuilderV2(Name, pb, base.Config{HealthCheck: true}).Build(cc, opts)
+	return &zoneBalancer{Balancer: b, v2: b.(balancer.V2Balancer), pb: pb}
+}
+
+func (zoneBuilder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	var config Config
+	if err := json.Unmarshal(js, &config); err != nil {
+		return nil, err
+	}
+	if config.CanaryPercent < 0 || config.CanaryPercent > 100 {
+		return nil, fmt.Errorf("%v: canaryPercent %v is not between 0 and 100", Name, config.CanaryPercent)
+	}
+	return &config, nil
+}
+
+// zoneBalancer is the base balancer, passing its config to the pickers.
+type zoneBalancer struct {
+	balancer.Balancer
+	v2 balancer.V2Balancer
+	pb *pickerBuilder
+}
+
+func (b *zoneBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	if config, ok := s.BalancerConfig.(*Config); ok {
+		b.pb.setConfig(*config)
+	}
+	return b.v2.UpdateClientConnState(s)
+}
+
+func (b *zoneBalancer) ResolverError(err error) {
+	b.v2.ResolverError(err)
+}
+
+func (b *zoneBalancer) UpdateSubConnState(sc balancer.SubConn, s balancer.SubConnState) {
+	b.v2.UpdateSubConnState(sc, s)
+}
+
+type pickerBuilder struct {
+	mu     sync.Mutex
+	config Config
+}
+
+func (pb *pickerBuilder) setConfig(config Config) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.config = config
+}
+
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	pb.mu.Lock()
+	config := pb.config
+	pb.mu.Unlock()
+
+	p := &picker{config: config}
+	for sc, scInfo := range info.ReadySCs {
+		e := endpoint{sc: sc, addr: scInfo.Address.Addr, md: grpc_resolver.AddressMetadata(scInfo.Address)}
+		p.all = append(p.all, e)
+		if e.md.Canary {
+			p.canaries = append(p.canaries, e)
+		} else {
+			p.stable = append(p.stable, e)
+		}
+	}
+	if len(p.stable) == 0 {
+		p.stable = p.all
+	}
+	return p
+}
+
+type endpoint struct {
+	sc   balancer.SubConn
+	addr string
+	md   grpc_resolver.Metadata
+}
+
+type picker struct {
+	config   Config
+	all      []endpoint
+	stable   []endpoint
+	canaries []endpoint
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	candidates := p.candidates(info.Ctx)
+	picks, _ := info.Ctx.Value(picksKey{}).(*picks)
+	if picks != nil {
+		// another zone rather than the same instance
+		candidates = picks.unpicked(candidates)
+	}
+
+	// drained instances of the local zone leave its calls to the other zones
+	e := pickWeighted(p.inZone(weighted(candidates)))
+	if picks != nil {
+		picks.add(e.addr)
+	}
+	return balancer.PickResult{SubConn: e.sc}, nil
+}
+
+// candidates returns the endpoints the call may go to: the instances of the
+// version asked for, the canaries when asked for or drawn, else the stable
+// instances.
+func (p *picker) candidates(ctx context.Context) []endpoint {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if versions := md.Get(VersionHeader); len(versions) > 0 {
+		var matching []endpoint
+		for _, e := range p.all {
+			if e.md.Version == versions[0] {
+				matching = append(matching, e)
+			}
+		}
+		if len(matching) > 0 {
+			return matching
+		}
+	}
+	if len(p.canaries) > 0 {
+		if canary := md.Get(CanaryHeader); len(canary) > 0 && canary[0] == "true" {
+			return p.canaries
+		}
+		if p.config.CanaryPercent > 0 && rand.Float64()*100 < p.config.CanaryPercent {
+			return p.canaries
+		}
+	}
+	return p.stable
+}
+
+// weighted returns the endpoints of positive weight, or all of them when none
+// is.
+func weighted(endpoints []endpoint) []endpoint {
+	var positive []endpoint
+	for _, e := range endpoints {
+		if e.md.Weight > 0 {
+			positive = append(positive, e)
+		}
+	}
+	if len(positive) == 0 {
+		return endpoints
+	}
+	return positive
+}
+
+// inZone returns the endpoints in the zone of the client, or all of them
+// when none is.
+func (p *picker) inZone(endpoints []endpoint) []endpoint {
+	if p.config.Zone == "" {
+		return endpoints
+	}
+	var local []endpoint
+	for _, e := range endpoints {
+		if e.md.Zone == p.config.Zone {
+			local = append(local, e)
+		}
+	}
+	if len(local) == 0 {
+		return endpoints
+	}
+	return local
+}
+
+// pickWeighted picks an endpoint in proportion to its weight. Endpoints of
+// weight 0 are picked only when all are.
+func pickWeighted(endpoints []endpoint) endpoint {
+	total := 0
+	for _, e := range endpoints {
+		total += e.md.Weight
+	}
+	if total == 0 {
+		return endpoints[rand.Intn(len(endpoints))]
+	}
+	n := rand.Intn(total)
+	for _, e := range endpoints {
+		if n < e.md.Weight {
+			return e
+		}
+		n -= e.md.Weight
+	}
+	return endpoints[len(endpoints)-1]
+}
@@ -0,0 +1,154 @@
+package grpc_balancer
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func buildPicker(config Config, instances map[string]grpc_resolver.Metadata) balancer.V2Picker {
+	pb := &pickerBuilder{config: config}
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for name, md := range instances {
+		info.ReadySCs[&fakeSubConn{name: name}] = base.SubConnInfo{Address: resolver.Address{Addr: name, Metadata: md}}
+	}
+	return pb.Build(info)
+}
+
+func pickCounts(t *testing.T, p balancer.V2Picker, ctx context.Context, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+		require.NoError(t, err)
+		counts[res.SubConn.(*fakeSubConn).name]++
+	}
+	return counts
+}
+
+func TestPicker(t *testing.T) {
+	p := buildPicker(Config{Zone: "a"}, map[string]grpc_resolver.Metadata{
+		"a1":     {Zone: "a", Weight: 3, Version: "v1"},
+		"a2":     {Zone: "a", Weight: 1, Version: "v1"},
+		"a3":     {Zone: "a", Weight: 0, Version: "v1"},
+		"b1":     {Zone: "b", Weight: 1, Version: "v1"},
+		"canary": {Zone: "b", Weight: 1, Version: "v2", Canary: true},
+	})
+
+	counts := pickCounts(t, p, context.Background(), 4000)
+	require.Equal(t, []string{"a1", "a2"}, keys(counts), "same zone, weight 0 excluded")
+	require.InDelta(t, 3, float64(counts["a1"])/float64(counts["a2"]), 0.5)
+
+	require.Equal(t, []string{"canary"}, keys(pickCounts(t, p, WithCanary(context.Background()), 100)))
+	require.Equal(t, []string{"canary"}, keys(pickCounts(t, p, WithVersion(context.Background(), "v2"), 100)))
+
+	t.Run("Distinct instances", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			ctx := WithDistinctInstances(context.Background())
+			counts := pickCounts(t, p, ctx, 3)
+			require.Equal(t, []string{"a1", "a2", "b1"}, keys(counts), "another zone once the zone is picked")
+		}
+
+		// all picked
+		ctx := WithDistinctInstances(context.Background())
+		pickCounts(t, p, ctx, 3)
+		require.Equal(t, []string{"a1", "a2"}, keys(pickCounts(t, p, ctx, 100)))
+	})
+
+	t.Run("Drained zone", func(t *testing.T) {
+		p := buildPicker(Config{Zone: "a"}, map[string]grpc_resolver.Metadata{
+			"a1": {Zone: "a", Weight: 0, Drained: true},
+			"b1": {Zone: "b", Weight: 1},
+		})
+		require.Equal(t, []string{"b1"}, keys(pickCounts(t, p, context.Background(), 100)), "the other zone rather than a drained instance")
+	})
+
+	t.Run("Canary percent", func(t *testing.T) {
+		p := buildPicker(Config{CanaryPercent: 20}, map[string]grpc_resolver.Metadata{
+			"stable": {Weight: 1},
+			"canary": {Weight: 1, Canary: true},
+		})
+		counts := pickCounts(t, p, context.Background(), 5000)
+		require.InDelta(t, 0.2, float64(counts["canary"])/5000, 0.03)
+	})
+}
+
+func TestZoneWeightedDial(t *testing.T) {
+	mem := discovery.NewMemory()
+	servers := make(map[string]string)
+	for _, zone := range []string{"a", "b"} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := grpc.NewServer()
+		healthpb.RegisterHealthServer(srv, health.NewServer())
+		go srv.Serve(lis)
+		defer srv.Stop()
+
+		port := lis.Addr().(*net.TCPAddr).Port
+		require.NoError(t, mem.Register(discovery.Instance{
+			Service: "health",
+			Address: "127.0.0.1",
+			Port:    port,
+			Meta:    grpc_resolver.Metadata{Zone: zone, Weight: 1}.Map(),
+		}))
+		servers[lis.Addr().String()] = zone
+	}
+
+	conn, err := grpc.Dial(mem.Target("health"), grpc.WithInsecure(), grpc.WithResolvers(mem.Builder()),
+		grpc.WithDisableServiceConfig(), grpc.WithDefaultServiceConfig(ServiceConfig(Config{Zone: "b"})))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := healthpb.NewHealthClient(conn)
+	check := func() string {
+		var p peer.Peer
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true), grpc.Peer(&p))
+		require.NoError(t, err)
+		return servers[p.Addr.String()]
+	}
+
+	// the other zone serves until the instance of zone b is ready
+	for check() != "b" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		require.Equal(t, "b", check())
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	_, err := zoneBuilder{}.ParseConfig([]byte(`{"canaryPercent": 120}`))
+	require.Error(t, err)
+	config, err := zoneBuilder{}.ParseConfig([]byte(`{"zone": "a", "canaryPercent": 5}`))
+	require.NoError(t, err)
+	require.Equal(t, &Config{Zone: "a", CanaryPercent: 5}, config)
+}
+
+func keys(counts map[string]int) []string {
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,126 @@
+package dialer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults of a Deadline.
+const (
+	// DefaultDeadlineMargin is kept from the deadline of the caller to
+	// handle the reply, e.g. 20ms of a server call due in 500ms leaves a
+	// budget of 480ms to the client call.
+	DefaultDeadlineMargin = 20 * time.Millisecond
+	// DefaultMinBudget is the budget under which a call fails fast.
+	DefaultMinBudget = 5 * time.Millisecond
+)
+
+// NewDeadline returns the deadlines of the calls of a client, bounded by
+// timeout unless their method has its own timeout. A zero timeout leaves
+// the calls bounded by the deadline of the caller only.
+func NewDeadline(timeout time.Duration) *Deadline {
+	return &Deadline{
+		timeout:   timeout,
+		methods:   make(map[string]time.Duration),
+		margin:    DefaultDeadlineMargin,
+		minBudget: DefaultMinBudget,
+	}
+}
+
+// Deadline holds the default timeouts of a client. Methods are named as in
+// Retry.
+type Deadline struct {
+	timeout   time.Duration
+	methods   map[string]time.Duration
+	margin    time.Duration
+	minBudget time.Duration
+}
+
+// WithMethodTimeout bounds the calls of method by timeout.
+func (d *Deadline) WithMethodTimeout(method string, timeout time.Duration) *Deadline {
+	d.methods[method] = timeout
+	return d
+}
+
+// WithMargin sets the time kept from the deadline of the caller.
+func (d *Deadline) WithMargin(margin time.Duration) *Deadline {
+	d.margin = margin
+	return d
+}
+
+// WithMinBudget sets the budget under which a call fails fast.
+func (d *Deadline) WithMinBudget(minBudget time.Duration) *Deadline {
+	d.minBudget = minBudget
+	return d
+}
+
+func (d *Deadline) timeoutFor(fullMethod string) time.Duration {
+	service := fullMethod[:strings.LastIndex(fullMethod, "/")+1] + "*"
+	for _, name := range []string{fullMethod, service} {
+		if timeout, ok := d.methods[name]; ok {
+			return timeout
+		}
+	}
+	return d.timeout
+}
+
+// deadline returns the deadline of a call of fullMethod made at now, the
+// earliest of the deadline of ctx less the margin and the timeout of the
+// method, and whether the call has one.
+func (d *Deadline) deadline(ctx context.Context, fullMethod string, now time.Time) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if ok {
+		deadline = deadline.Add(-d.margin)
+	}
+	if timeout := d.timeoutFor(fullMethod); timeout > 0 && (!ok || now.Add(timeout).Before(deadline)) {
+		return now.Add(timeout), true
+	}
+	return deadline, ok
+}
+
+// WithDeadline bounds the unary calls by the deadlines of d. Streams keep
+// the deadline of the caller. The hystrix timeout of a method is raised to its
+// timeout in d, the calls bounded by the deadline of their caller only keep
+// the hystrix timeout.
+func WithDeadline(d *Deadline) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.deadline = d
+		},
+	}
+}
+
+// DeadlineUnaryClientInterceptor bounds the unary calls by the deadlines of
+// d. The budget of each call is logged on its span, and a call with a budget
+// under the minimum fails with codes.DeadlineExceeded without being sent.
+func DeadlineUnaryClientInterceptor(d *Deadline) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		now := time.Now()
+		deadline, ok := d.deadline(ctx, method, now)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		budget := deadline.Sub(now)
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.LogFields(
+				otlog.String("event", "deadline budget"),
+				otlog.String("budget", budget.String()),
+			)
+		}
+		if budget < d.minBudget {
+			return status.Errorf(codes.DeadlineExceeded, "deadline budget %v is below %v", budget, d.minBudget)
+		}
+
+		ctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,64 @@
+package dialer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeadlineUnaryClientInterceptor(t *testing.T) {
+	d := NewDeadline(time.Second).
+		WithMethodTimeout("/payment.Report/*", time.Minute).
+		WithMargin(100 * time.Millisecond).
+		WithMinBudget(50 * time.Millisecond)
+	interceptor := DeadlineUnaryClientInterceptor(d)
+
+	var remaining time.Duration
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		remaining = time.Until(deadline)
+		return nil
+	}
+
+	t.Run("Default timeout", func(t *testing.T) {
+		require.NoError(t, interceptor(context.Background(), "/payment.Payment/GetOrder", nil, nil, nil, invoker))
+		require.InDelta(t, float64(time.Second), float64(remaining), float64(50*time.Millisecond))
+	})
+
+	t.Run("Method timeout", func(t *testing.T) {
+		require.NoError(t, interceptor(context.Background(), "/payment.Report/Daily", nil, nil, nil, invoker))
+		require.InDelta(t, float64(time.Minute), float64(remaining), float64(50*time.Millisecond))
+	})
+
+	t.Run("Caller budget less the margin", func(t *testing.T) {
+		tracer := mocktracer.New()
+		span := tracer.StartSpan("call")
+		ctx, cancel := context.WithTimeout(opentracing.ContextWithSpan(context.Background(), span), 500*time.Millisecond)
+		defer cancel()
+
+		require.NoError(t, interceptor(ctx, "/payment.Report/Daily", nil, nil, nil, invoker))
+		require.InDelta(t, float64(400*time.Millisecond), float64(remaining), float64(50*time.Millisecond))
+		span.Finish()
+		require.Equal(t, "deadline budget", tracer.FinishedSpans()[0].Logs()[0].Fields[0].ValueString)
+	})
+
+	t.Run("Fail fast", func(t *testing.T) {
+		calls = 0
+		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+		defer cancel()
+
+		err := interceptor(ctx, "/payment.Payment/GetOrder", nil, nil, nil, invoker)
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Equal(t, 0, calls)
+	})
+}
@@ -2,51 +2,265 @@ package dialer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"sort"
+	"sync"
 
 	consul "github.com/hashicorp/consul/api"
-	lb "github.com/olivere/grpc/lb/consul"
+	multierror "github.com/hashicorp/go-multierror"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/richard-xtek/go-grpc-micro-kit/auth/requestinfo"
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	grpc_balancer "github.com/richard-xtek/go-grpc-micro-kit/grpc-balancer"
 	grpc_logf "github.com/richard-xtek/go-grpc-micro-kit/grpc-logf"
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
 	logf "github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/breaker"
+	"github.com/richard-xtek/go-grpc-micro-kit/tlsconfig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 // NewGrpcClientDialer ...
 func NewGrpcClientDialer(consul *consul.Client, tracer opentracing.Tracer, logger logf.Factory) *GRPCClientDialer {
-	return &GRPCClientDialer{
-		consul: consul,
-		tracer: tracer,
-		logger: logger,
+	d := &GRPCClientDialer{
+		consul:  consul,
+		tracer:  tracer,
+		logger:  logger,
+		conns:   make(map[connKey]*cachedConn),
+		dialing: make(map[connKey]*dialCall),
 	}
+	d.dial = func(serviceName string, options clientOptions) (*grpc.ClientConn, error) {
+		return dialConsul(d.consul, serviceName, d.tracer, d.logger, options)
+	}
+	return d
 }
 
-// GRPCClientDialer ...
+// GRPCClientDialer dials the services registered in Consul and caches one
+// connection per service name and client name, see WithClientName.
 type GRPCClientDialer struct {
 	consul *consul.Client
 	tracer opentracing.Tracer
 	logger logf.Factory
+	dial   func(serviceName string, options clientOptions) (*grpc.ClientConn, error)
+
+	discovery discovery.Discovery
+	caller    string
+
+	mu      sync.Mutex
+	conns   map[connKey]*cachedConn
+	dialing map[connKey]*dialCall
+	closed  bool
+}
+
+// WithDiscovery finds the instances of the services through d instead of
+// Consul, unless a connection is dialed with its own WithDiscovery option.
+func (d *GRPCClientDialer) WithDiscovery(disc discovery.Discovery) *GRPCClientDialer {
+	d.discovery = disc
+	return d
+}
+
+// WithCaller propagates the request info and auth claims on the calls of
+// every connection, unless it is dialed with its own WithCaller option.
+func (d *GRPCClientDialer) WithCaller(caller string) *GRPCClientDialer {
+	d.caller = caller
+	return d
+}
+
+// connKey identifies a cached connection.
+type connKey struct {
+	serviceName string
+	clientName  string
+}
+
+// cachedConn is a cached connection and the options it was dialed with.
+type cachedConn struct {
+	conn    *grpc.ClientConn
+	options clientOptions
+}
+
+// dialCall is a dial in progress, shared by the calls waiting for it.
+type dialCall struct {
+	done    chan struct{}
+	options clientOptions
+	conn    *grpc.ClientConn
+	err     error
 }
 
-// ConnWithServiceName ...
+var (
+	// ErrDialerClosed is returned by the dialer once closed.
+	ErrDialerClosed = errors.New("dialer: closed")
+	// ErrOtherOptions is returned when a client asks for a connection cached
+	// with other options.
+	ErrOtherOptions = errors.New("dialer: the connection is dialed with other options")
+)
+
+// ConnWithServiceName returns the connection to serviceName dialed with
+// clientOpts, dialing it on the first call. The connection is shared by the
+// calls with the same client name, see WithClientName, and the same options:
+// a call with other options fails with ErrOtherOptions, name the clients
+// dialed with other options.
 func (d *GRPCClientDialer) ConnWithServiceName(serviceName string, clientOpts ...ClientOption) (*grpc.ClientConn, error) {
-	return NewGrpcClientConsul(d.consul, serviceName, d.tracer, d.logger, clientOpts...)
+	options := evaluateClientOptions(clientOpts)
+	if options.discovery == nil {
+		options.discovery = d.discovery
+	}
+	if options.caller == "" {
+		options.caller = d.caller
+	}
+	key := connKey{serviceName: serviceName, clientName: options.clientName}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil, ErrDialerClosed
+	}
+	if cached, ok := d.conns[key]; ok && cached.conn.GetState() != connectivity.Shutdown {
+		d.mu.Unlock()
+		if !cached.options.equal(options) {
+			return nil, errOtherOptions(key)
+		}
+		return cached.conn, nil
+	}
+	if call, ok := d.dialing[key]; ok {
+		d.mu.Unlock()
+		if !call.options.equal(options) {
+			return nil, errOtherOptions(key)
+		}
+		<-call.done
+		return call.conn, call.err
+	}
+	call := &dialCall{done: make(chan struct{}), options: options}
+	d.dialing[key] = call
+	d.mu.Unlock()
+
+	// the dial may read certificates, other services are not blocked
+	call.conn, call.err = d.dial(serviceName, options)
+
+	d.mu.Lock()
+	delete(d.dialing, key)
+	if call.err == nil {
+		if d.closed {
+			call.conn.Close()
+			call.conn, call.err = nil, ErrDialerClosed
+		} else {
+			d.conns[key] = &cachedConn{conn: call.conn, options: options}
+		}
+	}
+	d.mu.Unlock()
+	close(call.done)
+
+	return call.conn, call.err
 }
 
-// NewGrpcClientConsul return new client connection
-// consulAddress - consul server
-// serviceName - service name register in consul
-func NewGrpcClientConsul(cc *consul.Client, serviceName string, tracer opentracing.Tracer, logger logf.Factory, clientOpts ...ClientOption) (*grpc.ClientConn, error) {
-	var opts []grpc.DialOption
-	var options clientOptions
+func errOtherOptions(key connKey) error {
+	return fmt.Errorf("%w: service %s, client %q, see WithClientName", ErrOtherOptions, key.serviceName, key.clientName)
+}
+
+// ClientFactory builds a client stub on a connection, e.g.
+//
+//	func(conn *grpc.ClientConn) interface{} { return pb.NewPaymentClient(conn) }
+type ClientFactory func(conn *grpc.ClientConn) interface{}
+
+// Client returns the stub built by newClient on the connection to
+// serviceName, once the connection is ready or ctx is done:
+//
+//	c, err := d.Client(ctx, "payment", func(conn *grpc.ClientConn) interface{} {
+//		return pb.NewPaymentClient(conn)
+//	})
+//	paymentClient := c.(pb.PaymentClient)
+func (d *GRPCClientDialer) Client(ctx context.Context, serviceName string, newClient ClientFactory, clientOpts ...ClientOption) (interface{}, error) {
+	conn, err := d.ConnWithServiceName(serviceName, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
 
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			return nil, fmt.Errorf("dialer: connection to %s is %s: %v", serviceName, state, ctx.Err())
+		}
+	}
+	return newClient(conn), nil
+}
+
+// ConnState is the connectivity state of a cached connection.
+type ConnState struct {
+	ServiceName string
+	ClientName  string
+	State       connectivity.State
+}
+
+// States returns the state of the cached connections.
+func (d *GRPCClientDialer) States() []ConnState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	states := make([]ConnState, 0, len(d.conns))
+	for key, cached := range d.conns {
+		states = append(states, ConnState{ServiceName: key.serviceName, ClientName: key.clientName, State: cached.conn.GetState()})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].ServiceName != states[j].ServiceName {
+			return states[i].ServiceName < states[j].ServiceName
+		}
+		return states[i].ClientName < states[j].ClientName
+	})
+	return states
+}
+
+// Check fails when a cached connection is failing or shut down, so the dialer
+// is a health.Checker.
+func (d *GRPCClientDialer) Check(ctx context.Context) error {
+	var result error
+	for _, s := range d.States() {
+		switch s.State {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			result = multierror.Append(result, fmt.Errorf("connection to %s is %s", s.ServiceName, s.State))
+		}
+	}
+	return result
+}
+
+// Close closes the cached connections. The dialer cannot dial afterwards.
+func (d *GRPCClientDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var result error
+	for key, cached := range d.conns {
+		if err := cached.conn.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("close connection to %s: %v", key.serviceName, err))
+		}
+		delete(d.conns, key)
+	}
+	d.closed = true
+	return result
+}
+
+func evaluateClientOptions(clientOpts []ClientOption) clientOptions {
+	var options clientOptions
 	for _, option := range clientOpts {
 		option.apply(&options)
 	}
+	return options
+}
+
+// NewGrpcClientConsul return new client connection
+// consulAddress - consul server
+// serviceName - service name register in consul, resolved to its instances
+// passing their health checks
+func NewGrpcClientConsul(cc *consul.Client, serviceName string, tracer opentracing.Tracer, logger logf.Factory, clientOpts ...ClientOption) (*grpc.ClientConn, error) {
+	return dialConsul(cc, serviceName, tracer, logger, evaluateClientOptions(clientOpts))
+}
+
+func dialConsul(cc *consul.Client, serviceName string, tracer opentracing.Tracer, logger logf.Factory, options clientOptions) (*grpc.ClientConn, error) {
+	var opts []grpc.DialOption
 
 	if options.proxyDialer != nil {
 		proxyDialer := func(ctx context.Context, addr string) (conn net.Conn, err error) {
@@ -55,52 +269,112 @@ func NewGrpcClientConsul(cc *consul.Client, serviceName string, tracer opentraci
 		opts = append(opts, grpc.WithContextDialer(proxyDialer))
 	}
 
-	alwaysLoggingDeciderClient := func(ctx context.Context, fullMethodName string) bool { return true }
+	var (
+		unary  []grpc.UnaryClientInterceptor
+		stream []grpc.StreamClientInterceptor
+	)
+	if options.caller != "" {
+		var propagation []requestinfo.ClientOption
+		if options.forwardAuthorization {
+			propagation = append(propagation, requestinfo.WithAuthorization())
+		}
+		unary = append(unary, requestinfo.UnaryClientInterceptor(options.caller, propagation...))
+		stream = append(stream, requestinfo.StreamClientInterceptor(options.caller, propagation...))
+	}
+	b := defaultBreaker
+	if options.breaker != nil {
+		b = options.breaker
+	}
+	if options.deadline != nil {
+		// before the retries, which share the budget of the call, and bounding
+		// the calls instead of the hystrix timeout
+		unary = append(unary, DeadlineUnaryClientInterceptor(options.deadline))
+		b = b.BoundedBy(options.deadline.timeoutFor)
+	}
+	if options.hedge != nil {
+		unary = append(unary, HedgeUnaryClientInterceptor(options.hedge))
+	}
+	if options.retry != nil {
+		// inside the interceptor chain, so every attempt runs in the span of the call
+		unary = append(unary, RetryUnaryClientInterceptor(options.retry))
+	}
+	opts = append(opts, interceptorDialOptions(tracer, logger, b, unary, stream)...)
 
-	// optsRetry := []grpc_retry.CallOption{
-	// 	grpc_retry.WithBackoff(grpc_retry.BackoffExponential(50 * time.Millisecond)),
-	// 	grpc_retry.WithCodes(codes.Unavailable),
-	// 	grpc_retry.WithMax(3),
-	// 	grpc_retry.WithPerRetryTimeout(3 * time.Second),
-	// }
+	// consul by default, balanced round robin by the service config of the resolver
+	disc := options.discovery
+	if disc == nil {
+		disc = discovery.NewConsul(cc, logger)
+	}
+	if builder, ok := disc.Builder().(*grpc_resolver.ConsulBuilder); ok {
+		opts = append(opts, builder.DialOption())
+	} else {
+		opts = append(opts, grpc.WithResolvers(disc.Builder()))
+	}
+	if options.hedge != nil && !options.balanced {
+		// round robin may send a copy to the instance of the call
+		options.balanced = true
+	}
+	if options.balanced {
+		// the service config of the resolver would balance round robin
+		opts = append(opts,
+			grpc.WithDisableServiceConfig(),
+			grpc.WithDefaultServiceConfig(grpc_balancer.ServiceConfig(options.balancer)),
+		)
+	}
+
+	if options.tlsEnabled {
+		reloader, err := tlsconfig.NewReloader(options.tlsCertFile, options.tlsKeyFile, options.tlsCAFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(tlsconfig.NewClientCredentials(reloader, options.tlsServerName)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	conn, err := grpc.Dial(disc.Target(serviceName), opts...)
+
+	return conn, err
+}
+
+// InterceptorDialOptions returns the dial options installing the client
+// interceptor chain used by NewGrpcClientConsul: tracing, prometheus, logging
+// and hystrix. Use it to dial a connection that is not resolved by Consul.
+func InterceptorDialOptions(tracer opentracing.Tracer, logger logf.Factory) []grpc.DialOption {
+	return interceptorDialOptions(tracer, logger, defaultBreaker, nil, nil)
+}
+
+// interceptorDialOptions chains tracing, prometheus, logging, then the
+// interceptors of the client, then the breaker, so that each attempt of a
+// retried or hedged call is a sample of the circuit.
+func interceptorDialOptions(tracer opentracing.Tracer, logger logf.Factory, b *breaker.Breaker, unary []grpc.UnaryClientInterceptor, stream []grpc.StreamClientInterceptor) []grpc.DialOption {
+	alwaysLoggingDeciderClient := func(ctx context.Context, fullMethodName string) bool { return true }
 
 	// opts = append(opts,
 	// 	grpc.WithDefaultCallOptions(grpc.FailFast(false)),
 	// )
 
-	sIntOpt := grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(
-		StreamClientInterceptor(),
+	streamChain := append([]grpc.StreamClientInterceptor{
 		grpc_opentracing.StreamClientInterceptor(grpc_opentracing.WithTracer(tracer)),
 		grpc_prometheus.StreamClientInterceptor,
 		grpc_logf.StreamClientInterceptor(logger),
 		grpc_logf.PayloadStreamClientInterceptor(logger, alwaysLoggingDeciderClient),
-		// grpc_retry.StreamClientInterceptor(optsRetry...),
+	}, stream...)
+	sIntOpt := grpc.WithStreamInterceptor(grpc_middleware.ChainStreamClient(
+		append(streamChain, breaker.StreamClientInterceptor(b))...,
 	))
 
-	opts = append(opts, sIntOpt)
-
 	grpc_prometheus.EnableClientHandlingTimeHistogram()
 
-	uIntOpt := grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
-		UnaryClientInterceptor(),
+	unaryChain := append([]grpc.UnaryClientInterceptor{
 		grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(tracer)),
 		grpc_prometheus.UnaryClientInterceptor,
 		grpc_logf.UnaryClientInterceptor(logger),
 		grpc_logf.PayloadUnaryClientInterceptor(logger, alwaysLoggingDeciderClient),
-		// grpc_retry.UnaryClientInterceptor(optsRetry...),
+	}, unary...)
+	uIntOpt := grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
+		append(unaryChain, breaker.UnaryClientInterceptor(b))...,
 	))
 
-	// consule
-	r, err := lb.NewResolver(cc, serviceName, "")
-	if err != nil {
-		return nil, err
-	}
-
-	b := grpc.RoundRobin(r)
-
-	opts = append(opts, uIntOpt, grpc.WithInsecure(), grpc.WithBalancer(b))
-
-	conn, err := grpc.Dial(serviceName, opts...)
-
-	return conn, err
+	return []grpc.DialOption{sIntOpt, uIntOpt}
 }
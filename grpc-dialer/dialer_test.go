@@ -0,0 +1,138 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/breaker"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestGRPCClientDialer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	d := NewGrpcClientDialer(nil, nil, log.NewFactory(zap.NewNop()))
+	var dials int32
+	d.dial = func(serviceName string, options clientOptions) (*grpc.ClientConn, error) {
+		atomic.AddInt32(&dials, 1)
+		return grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	}
+
+	conn1, err := d.ConnWithServiceName("health", WithRetry(NewRetry(DefaultRetryPolicy)))
+	require.NoError(t, err)
+	conn2, err := d.ConnWithServiceName("health", WithRetry(NewRetry(DefaultRetryPolicy)))
+	require.NoError(t, err)
+	require.True(t, conn1 == conn2, "the connection is cached")
+
+	_, err = d.ConnWithServiceName("health", WithTLS(""))
+	require.True(t, errors.Is(err, ErrOtherOptions), "the cached connection is not returned for other options: %v", err)
+
+	_, err = d.ConnWithServiceName("health", WithClientName("other"), WithTLSServerName("other"))
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&dials), "other clients dial another connection")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := d.Client(ctx, "health", func(conn *grpc.ClientConn) interface{} {
+		return healthpb.NewHealthClient(conn)
+	}, WithRetry(NewRetry(DefaultRetryPolicy)))
+	require.NoError(t, err)
+	resp, err := c.(healthpb.HealthClient).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	require.Contains(t, d.States(), ConnState{ServiceName: "health", State: connectivity.Ready})
+	require.Equal(t, "other", d.States()[1].ClientName)
+	require.NoError(t, d.Check(ctx))
+
+	require.NoError(t, d.Close())
+	require.Equal(t, connectivity.Shutdown, conn1.GetState())
+	_, err = d.ConnWithServiceName("health")
+	require.Equal(t, ErrDialerClosed, err)
+}
+
+func TestGRPCClientDialer_concurrentDials(t *testing.T) {
+	d := NewGrpcClientDialer(nil, nil, log.NewFactory(zap.NewNop()))
+	release := make(chan struct{})
+	var dials int32
+	d.dial = func(serviceName string, options clientOptions) (*grpc.ClientConn, error) {
+		atomic.AddInt32(&dials, 1)
+		if serviceName == "slow" {
+			<-release
+		}
+		return grpc.Dial("127.0.0.1:1", grpc.WithInsecure())
+	}
+	defer d.Close()
+
+	conns := make(chan *grpc.ClientConn, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			conn, _ := d.ConnWithServiceName("slow")
+			conns <- conn
+		}()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&dials) == 1 }, time.Second, time.Millisecond)
+
+	// other services are dialed while slow is
+	_, err := d.ConnWithServiceName("fast")
+	require.NoError(t, err)
+
+	close(release)
+	conn1, conn2 := <-conns, <-conns
+	require.NotNil(t, conn1)
+	require.True(t, conn1 == conn2, "one dial per connection")
+	require.Equal(t, int32(2), atomic.LoadInt32(&dials))
+}
+
+// slowService answers Ping after delay.
+type slowService struct {
+	pb_testproto.TestServiceServer
+	delay time.Duration
+}
+
+func (s *slowService) Ping(ctx context.Context, req *pb_testproto.PingRequest) (*pb_testproto.PingResponse, error) {
+	time.Sleep(s.delay)
+	return &pb_testproto.PingResponse{Value: req.Value}, nil
+}
+
+func TestNewGrpcClientConsul_deadline(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	pb_testproto.RegisterTestServiceServer(srv, &slowService{delay: 100 * time.Millisecond})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	method := "/mwitkow.testproto.TestService/Ping"
+	conn, err := NewGrpcClientConsul(nil, "test", opentracing.NoopTracer{}, log.NewFactory(zap.NewNop()),
+		WithDiscovery(discovery.NewStatic(map[string][]string{"test": {lis.Addr().String()}})),
+		WithBreaker(breaker.NewBreaker().WithMethodConfig(method, hystrix.CommandConfig{Timeout: 20})),
+		WithDeadline(NewDeadline(time.Second)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the deadline of the client bounds the call, not the hystrix timeout
+	resp, err := pb_testproto.NewTestServiceClient(conn).Ping(context.Background(), &pb_testproto.PingRequest{Value: "ping"})
+	require.NoError(t, err)
+	require.Equal(t, "ping", resp.Value)
+}
@@ -1,36 +1,37 @@
 package dialer
 
 import (
-	"context"
-
-	"github.com/afex/hystrix-go/hystrix"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/breaker"
 	"github.com/richard-xtek/go-grpc-micro-kit/monitor/hystrixconfig"
 	"google.golang.org/grpc"
 )
 
-// HystrixEnableFlag is a flag for enable/disable hystrix
+// HystrixEnableFlag is a flag for enable/disable hystrix. The runtime toggle
+// hystrixconfig.SetEnabled overrides it either way. Use WithBreaker to always
+// run the calls of a client through a configured breaker.
 var HystrixEnableFlag = false
 
+// defaultBreaker runs the calls through hystrix while it is enabled.
+var defaultBreaker = breaker.NewBreaker().WithEnabled(func() bool {
+	return hystrixconfig.EnabledOr(HystrixEnableFlag)
+})
+
 // UnaryClientInterceptor ...
 func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		if HystrixEnableFlag {
-			hystrix.ConfigureCommand(method, hystrixconfig.HystrixConfig())
-
-			err := hystrix.Do(method, func() (err error) {
-				err = invoker(ctx, method, req, reply, cc, opts...)
-				return err
-			}, nil)
-
-			return err
-		}
-		return invoker(ctx, method, req, reply, cc, opts...)
-	}
+	return breaker.UnaryClientInterceptor(defaultBreaker)
 }
 
 // StreamClientInterceptor ...
 func StreamClientInterceptor() grpc.StreamClientInterceptor {
-	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-		return streamer(ctx, desc, cc, method, opts...)
+	return breaker.StreamClientInterceptor(defaultBreaker)
+}
+
+// WithBreaker runs the calls of the client through b instead of the hystrix
+// commands toggled by HystrixEnableFlag.
+func WithBreaker(b *breaker.Breaker) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.breaker = b
+		},
 	}
 }
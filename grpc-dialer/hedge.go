@@ -0,0 +1,267 @@
+package dialer
+
+import (
+	"context"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	opentracing "github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	grpc_balancer "github.com/richard-xtek/go-grpc-micro-kit/grpc-balancer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+var (
+	hedgesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_hedged_requests_total",
+		Help: "Total number of hedged copies of gRPC calls sent by the client.",
+	}, []string{"grpc_service", "grpc_method"})
+	hedgeWinsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_hedge_wins_total",
+		Help: "Total number of gRPC calls answered by their hedged copy.",
+	}, []string{"grpc_service", "grpc_method"})
+)
+
+const (
+	// hedgeWindow is the number of latencies kept per method.
+	hedgeWindow = 128
+	// hedgeMinSamples is the number of latencies needed to use a percentile.
+	hedgeMinSamples = 20
+)
+
+// NewHedge returns the hedging of the calls of a client, sending a copy of
+// a call unanswered after delay. Only the methods marked safe are hedged.
+func NewHedge(delay time.Duration) *Hedge {
+	return &Hedge{
+		delay:     delay,
+		safe:      make(map[string]bool),
+		latencies: make(map[string]*latencyWindow),
+	}
+}
+
+// Hedge holds the hedging of a client. Methods are named as in Retry.
+type Hedge struct {
+	delay      time.Duration
+	percentile float64
+	safe       map[string]bool
+
+	mu        sync.Mutex
+	latencies map[string]*latencyWindow
+}
+
+// equal reports whether h and other hedge the same methods with the same delay.
+func (h *Hedge) equal(other *Hedge) bool {
+	return h.delay == other.delay && h.percentile == other.percentile && reflect.DeepEqual(h.safe, other.safe)
+}
+
+// WithSafe marks methods safe to hedge, i.e. reads which can run twice.
+func (h *Hedge) WithSafe(methods ...string) *Hedge {
+	for _, method := range methods {
+		h.safe[method] = true
+	}
+	return h
+}
+
+// WithLatencyPercentile sends the copy after the percentile p of the recent
+// latencies of the method, e.g. 0.95, instead of the delay. The delay is used
+// until enough calls are measured.
+func (h *Hedge) WithLatencyPercentile(p float64) *Hedge {
+	h.percentile = p
+	return h
+}
+
+func (h *Hedge) hedged(fullMethod string) bool {
+	service := fullMethod[:strings.LastIndex(fullMethod, "/")+1] + "*"
+	return h.safe[fullMethod] || h.safe[service]
+}
+
+// delayFor returns the wait before the copy of a call of fullMethod.
+func (h *Hedge) delayFor(fullMethod string) time.Duration {
+	if h.percentile <= 0 {
+		return h.delay
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if w, ok := h.latencies[fullMethod]; ok {
+		if delay, ok := w.percentile(h.percentile); ok {
+			return delay
+		}
+	}
+	return h.delay
+}
+
+func (h *Hedge) observe(fullMethod string, latency time.Duration) {
+	if h.percentile <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.latencies[fullMethod]
+	if !ok {
+		w = &latencyWindow{}
+		h.latencies[fullMethod] = w
+	}
+	w.add(latency)
+}
+
+// latencyWindow keeps the last hedgeWindow latencies.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	if len(w.samples) < hedgeWindow {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % hedgeWindow
+}
+
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	if len(w.samples) < hedgeMinSamples {
+		return 0, false
+	}
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i], true
+}
+
+// WithHedge hedges the unary calls of the methods marked safe in hedge.
+// Streams are not hedged. The client balances with the zone weighted
+// balancer, configured by WithBalancer, so that the copies go to other
+// instances.
+func WithHedge(hedge *Hedge) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.hedge = hedge
+		},
+	}
+}
+
+// HedgeUnaryClientInterceptor sends a copy of a call of a safe method still
+// unanswered after the delay of hedge, and returns the first successful
+// reply, cancelling the other call. The copy goes to another instance than the
+// call when the connection balances with the zone weighted balancer, which
+// the dialer uses for the hedged clients. A call failing before its copy is
+// sent fails without a copy; retries are left to Retry. The header, trailer
+// and peer call options receive the ones of the call returned.
+// The copies are counted in grpc_client_hedged_requests_total and the calls
+// answered by their copy in grpc_client_hedge_wins_total.
+func HedgeUnaryClientInterceptor(hedge *Hedge) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		msg, ok := reply.(proto.Message)
+		if !ok || !hedge.hedged(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(grpc_balancer.WithDistinctInstances(ctx))
+		defer cancel()
+
+		type result struct {
+			reply  proto.Message
+			err    error
+			hedged bool
+			took   time.Duration
+			commit func()
+		}
+		results := make(chan result, 2)
+		send := func(hedged bool) {
+			start := time.Now()
+			tmp := proto.Clone(msg)
+			tmp.Reset()
+			callOpts, commit := ownOutputs(opts)
+			err := invoker(ctx, method, req, tmp, cc, callOpts...)
+			results <- result{reply: tmp, err: err, hedged: hedged, took: time.Since(start), commit: commit}
+		}
+
+		go send(false)
+		timer := time.NewTimer(hedge.delayFor(method))
+		defer timer.Stop()
+
+		service, name := strings.TrimPrefix(path.Dir(method), "/"), path.Base(method)
+		inflight, hedged := 1, false
+		for {
+			select {
+			case <-timer.C:
+				hedged = true
+				inflight++
+				hedgesTotal.WithLabelValues(service, name).Inc()
+				if span := opentracing.SpanFromContext(ctx); span != nil {
+					span.LogFields(otlog.String("event", "hedge"))
+				}
+				go send(true)
+
+			case r := <-results:
+				inflight--
+				if r.err != nil {
+					if hedged && inflight > 0 {
+						// wait for the other call
+						continue
+					}
+					r.commit()
+					return r.err
+				}
+
+				r.commit()
+				hedge.observe(method, r.took)
+				if r.hedged {
+					hedgeWinsTotal.WithLabelValues(service, name).Inc()
+				}
+				msg.Reset()
+				proto.Merge(msg, r.reply)
+				return nil
+			}
+		}
+	}
+}
+
+// ownOutputs returns opts with their own header, trailer and peer outputs,
+// so that concurrent copies of a call do not write the ones of the caller,
+// and commit copying them to the outputs of the caller.
+func ownOutputs(opts []grpc.CallOption) (own []grpc.CallOption, commit func()) {
+	own = make([]grpc.CallOption, len(opts))
+	var commits []func()
+	for i, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			md := new(metadata.MD)
+			own[i] = grpc.Header(md)
+			commits = append(commits, func() { *o.HeaderAddr = *md })
+		case grpc.TrailerCallOption:
+			md := new(metadata.MD)
+			own[i] = grpc.Trailer(md)
+			commits = append(commits, func() { *o.TrailerAddr = *md })
+		case grpc.PeerCallOption:
+			p := new(peer.Peer)
+			own[i] = grpc.Peer(p)
+			commits = append(commits, func() { *o.PeerAddr = *p })
+		default:
+			own[i] = opt
+		}
+	}
+	return own, func() {
+		for _, c := range commits {
+			c()
+		}
+	}
+}
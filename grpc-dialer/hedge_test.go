@@ -0,0 +1,136 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestHedgeUnaryClientInterceptor(t *testing.T) {
+	hedge := NewHedge(10 * time.Millisecond).WithSafe("/grpc.health.v1.Health/Check")
+	interceptor := HedgeUnaryClientInterceptor(hedge)
+
+	// the first call hangs until cancelled, the copy answers
+	var (
+		calls     int32
+		cancelled = make(chan struct{})
+	)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		}
+		reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+		return nil
+	}
+
+	wins := testutil.ToFloat64(hedgeWinsTotal.WithLabelValues("grpc.health.v1.Health", "Check"))
+	reply := &healthpb.HealthCheckResponse{}
+	require.NoError(t, interceptor(context.Background(), "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{}, reply, nil, invoker))
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, reply.Status)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	require.Equal(t, wins+1, testutil.ToFloat64(hedgeWinsTotal.WithLabelValues("grpc.health.v1.Health", "Check")))
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the first call is not cancelled")
+	}
+
+	t.Run("Header", func(t *testing.T) {
+		// each call writes its own header, the caller gets the one of the reply
+		var calls int32
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			n := atomic.AddInt32(&calls, 1)
+			for _, opt := range opts {
+				if h, ok := opt.(grpc.HeaderCallOption); ok {
+					*h.HeaderAddr = metadata.Pairs("call", strconv.Itoa(int(n)))
+				}
+			}
+			if n == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}
+
+		var header metadata.MD
+		require.NoError(t, interceptor(context.Background(), "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{},
+			&healthpb.HealthCheckResponse{}, nil, invoker, grpc.Header(&header)))
+		require.Equal(t, []string{"2"}, header.Get("call"))
+	})
+
+	t.Run("Unsafe method", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		cancelled = make(chan struct{})
+		err := interceptor(ctx, "/grpc.health.v1.Health/Watch", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{}, nil, invoker)
+		require.Error(t, err)
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestHedgeLatencyPercentile(t *testing.T) {
+	hedge := NewHedge(time.Second).WithLatencyPercentile(0.95)
+	require.Equal(t, time.Second, hedge.delayFor("/svc/Method"), "the delay is used until enough calls are measured")
+
+	for i := 1; i <= 100; i++ {
+		hedge.observe("/svc/Method", time.Duration(i)*time.Millisecond)
+	}
+	require.Equal(t, 95*time.Millisecond, hedge.delayFor("/svc/Method"))
+}
+
+func TestHedgeDistinctInstances(t *testing.T) {
+	var addrs []string
+	for _, delay := range []time.Duration{time.Second, 0} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := grpc.NewServer()
+		pb_testproto.RegisterTestServiceServer(srv, &slowService{delay: delay})
+		go srv.Serve(lis)
+		defer srv.Stop()
+		addrs = append(addrs, lis.Addr().String())
+	}
+
+	method := "/mwitkow.testproto.TestService/Ping"
+	conn, err := NewGrpcClientConsul(nil, "test", opentracing.NoopTracer{}, log.NewFactory(zap.NewNop()),
+		WithDiscovery(discovery.NewStatic(map[string][]string{"test": addrs})),
+		WithHedge(NewHedge(10*time.Millisecond).WithSafe(method)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := pb_testproto.NewTestServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Eventually(t, func() bool {
+		return conn.GetState() == connectivity.Ready
+	}, time.Second, 5*time.Millisecond)
+	// both local instances are ready by then
+	time.Sleep(50 * time.Millisecond)
+
+	// the copy of a call to the slow instance goes to the fast one
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		_, err := client.Ping(ctx, &pb_testproto.PingRequest{Value: "ping"})
+		require.NoError(t, err)
+		require.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	}
+}
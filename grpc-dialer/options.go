@@ -1,9 +1,77 @@
 package dialer
 
-import "golang.org/x/net/proxy"
+import (
+	"reflect"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	grpc_balancer "github.com/richard-xtek/go-grpc-micro-kit/grpc-balancer"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/breaker"
+	"golang.org/x/net/proxy"
+)
 
 type clientOptions struct {
 	proxyDialer proxy.Dialer
+
+	tlsEnabled    bool
+	tlsCertFile   string
+	tlsKeyFile    string
+	tlsCAFile     string
+	tlsServerName string
+
+	retry     *Retry
+	deadline  *Deadline
+	hedge     *Hedge
+	breaker   *breaker.Breaker
+	discovery discovery.Discovery
+	caller    string
+	// forwardAuthorization forwards the authorization of the end user
+	forwardAuthorization bool
+
+	clientName string
+
+	balancer grpc_balancer.Config
+	balanced bool
+}
+
+// equal reports whether connections dialed with o and other behave the same.
+// The retry, deadline and hedge policies are compared by value, so clients
+// building their own equal policies share a connection.
+func (o clientOptions) equal(other clientOptions) bool {
+	if !sameValue(o.proxyDialer, other.proxyDialer) || !sameValue(o.discovery, other.discovery) {
+		return false
+	}
+	if o.tlsEnabled != other.tlsEnabled || o.tlsCertFile != other.tlsCertFile || o.tlsKeyFile != other.tlsKeyFile ||
+		o.tlsCAFile != other.tlsCAFile || o.tlsServerName != other.tlsServerName {
+		return false
+	}
+	if o.caller != other.caller || o.forwardAuthorization != other.forwardAuthorization || o.clientName != other.clientName {
+		return false
+	}
+	if o.balanced != other.balanced || o.balancer != other.balancer || o.breaker != other.breaker {
+		return false
+	}
+	if (o.retry == nil) != (other.retry == nil) || o.retry != nil && !reflect.DeepEqual(*o.retry, *other.retry) {
+		return false
+	}
+	if (o.deadline == nil) != (other.deadline == nil) || o.deadline != nil && !reflect.DeepEqual(*o.deadline, *other.deadline) {
+		return false
+	}
+	if (o.hedge == nil) != (other.hedge == nil) || o.hedge != nil && !o.hedge.equal(other.hedge) {
+		return false
+	}
+	return true
+}
+
+// sameValue compares a and b with ==, or by value when their type is not
+// comparable.
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return a == b
+	}
+	if !reflect.TypeOf(a).Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
+	return a == b
 }
 
 // ClientOption ...
@@ -28,3 +96,96 @@ func WithClientProxy(dialer proxy.Dialer) ClientOption {
 		},
 	}
 }
+
+// WithTLS dials over TLS, verifying the server certificate against caFile, or
+// against the system roots when caFile is empty. The CA bundle is reloaded
+// when the file changes.
+func WithTLS(caFile string) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.tlsEnabled = true
+			options.tlsCAFile = caFile
+		},
+	}
+}
+
+// WithMTLS dials over mutual TLS, presenting the given certificate key pair
+// and verifying the server certificate against caFile. The files are reloaded
+// when they change.
+func WithMTLS(certFile, keyFile, caFile string) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.tlsEnabled = true
+			options.tlsCertFile = certFile
+			options.tlsKeyFile = keyFile
+			options.tlsCAFile = caFile
+		},
+	}
+}
+
+// WithTLSServerName overrides the server name used to verify the server
+// certificate. By default it is the dialed service name.
+func WithTLSServerName(serverName string) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.tlsServerName = serverName
+		},
+	}
+}
+
+// WithClientName names the client of a GRPCClientDialer, which caches one
+// connection per service and client name. Clients dialing a service with other
+// options, e.g. another Retry policy, need their own name: the dialer fails
+// with ErrOtherOptions instead of returning a connection dialed otherwise.
+func WithClientName(name string) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.clientName = name
+		},
+	}
+}
+
+// WithDiscovery finds the instances of the service through d instead of
+// Consul, e.g. a discovery.Static list in local development.
+func WithDiscovery(d discovery.Discovery) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.discovery = d
+		},
+	}
+}
+
+// WithCaller propagates the request info and auth claims of the calling
+// request to the called service, adding caller, the name of the calling
+// service, to the chain of callers. See requestinfo.UnaryClientInterceptor.
+func WithCaller(caller string) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.caller = caller
+		},
+	}
+}
+
+// WithForwardedAuthorization forwards the bearer token of the end user to
+// the called service along the request info of WithCaller. Only use it for
+// the services trusted with the credentials of the users.
+func WithForwardedAuthorization() ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.forwardAuthorization = true
+		},
+	}
+}
+
+// WithBalancer balances the calls with the zone weighted balancer configured
+// by config instead of round robin: instances in the zone of the client are
+// preferred, weights are respected and canaries receive their share of the
+// calls. The instances are described by their registered metadata.
+func WithBalancer(config grpc_balancer.Config) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.balancer = config
+			options.balanced = true
+		},
+	}
+}
@@ -0,0 +1,207 @@
+package dialer
+
+import (
+	"context"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_client_retries_total",
+	Help: "Total number of gRPC calls retried by the client, by the code of the failed attempt.",
+}, []string{"grpc_service", "grpc_method", "grpc_code"})
+
+// RetryPolicy decides how a failed call is retried.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so 1 disables the retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It is multiplied by
+	// BackoffMultiplier before every following retry, up to MaxBackoff.
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	// Jitter randomizes the backoff by up to this fraction, e.g. 0.2 waits
+	// between 80% and 120% of the backoff.
+	Jitter float64
+	// RetryableCodes are the codes of the failed attempts which are retried.
+	RetryableCodes []codes.Code
+	// PerAttemptTimeout bounds each attempt. Zero leaves only the deadline of
+	// the caller.
+	PerAttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy retries codes.Unavailable twice.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       3,
+	InitialBackoff:    50 * time.Millisecond,
+	MaxBackoff:        time.Second,
+	BackoffMultiplier: 2,
+	Jitter:            0.2,
+	RetryableCodes:    []codes.Code{codes.Unavailable},
+}
+
+func (p RetryPolicy) retryable(code codes.Code) bool {
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the retry following attempt, counted
+// from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= p.BackoffMultiplier
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(backoff)
+}
+
+// NewRetry returns the retry policies of a client. Only the methods marked
+// idempotent, and the methods with their own policy, are retried.
+func NewRetry(policy RetryPolicy) *Retry {
+	return &Retry{
+		policy:     policy,
+		idempotent: make(map[string]bool),
+		methods:    make(map[string]RetryPolicy),
+	}
+}
+
+// Retry holds the retry policies of a client. Methods are named by their
+// full name, e.g. /payment.Payment/GetOrder, or by their service followed by
+// a star, e.g. /payment.Payment/*.
+type Retry struct {
+	policy     RetryPolicy
+	idempotent map[string]bool
+	methods    map[string]RetryPolicy
+}
+
+// WithIdempotent marks methods safe to retry with the default policy.
+func (r *Retry) WithIdempotent(methods ...string) *Retry {
+	for _, method := range methods {
+		r.idempotent[method] = true
+	}
+	return r
+}
+
+// WithMethodPolicy retries method with policy.
+func (r *Retry) WithMethodPolicy(method string, policy RetryPolicy) *Retry {
+	r.methods[method] = policy
+	return r
+}
+
+// policyFor returns the policy of fullMethod and whether it is retried.
+func (r *Retry) policyFor(fullMethod string) (RetryPolicy, bool) {
+	service := fullMethod[:strings.LastIndex(fullMethod, "/")+1] + "*"
+	for _, name := range []string{fullMethod, service} {
+		if policy, ok := r.methods[name]; ok {
+			return policy, policy.MaxAttempts > 1
+		}
+	}
+	for _, name := range []string{fullMethod, service} {
+		if r.idempotent[name] {
+			return r.policy, r.policy.MaxAttempts > 1
+		}
+	}
+	return RetryPolicy{}, false
+}
+
+// WithRetry retries the failed unary calls as decided by retry. Streams are
+// not retried.
+func WithRetry(retry *Retry) ClientOption {
+	return &functionClientOption{
+		f: func(options *clientOptions) {
+			options.retry = retry
+		},
+	}
+}
+
+// RetryUnaryClientInterceptor retries the failed unary calls as decided by
+// retry. Each retry is logged on the span of the call and counted in
+// grpc_client_retries_total. No retry starts when the deadline of the caller
+// leaves no time for the backoff and another attempt.
+func RetryUnaryClientInterceptor(retry *Retry) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy, ok := retry.policyFor(method)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		var err error
+		for attempt := 1; ; attempt++ {
+			if err = invokeAttempt(ctx, policy, method, req, reply, cc, invoker, opts...); err == nil {
+				return nil
+			}
+			code := status.Code(err)
+			if attempt >= policy.MaxAttempts || !policy.retryable(code) {
+				return err
+			}
+
+			backoff := policy.backoff(attempt)
+			if !fitsDeadline(ctx, backoff, policy.PerAttemptTimeout) {
+				return err
+			}
+
+			service, name := path.Dir(method), path.Base(method)
+			retriesTotal.WithLabelValues(strings.TrimPrefix(service, "/"), name, code.String()).Inc()
+			if span := opentracing.SpanFromContext(ctx); span != nil {
+				span.LogFields(
+					otlog.String("event", "retry"),
+					otlog.Int("attempt", attempt+1),
+					otlog.String("grpc.code", code.String()),
+					otlog.String("backoff", backoff.String()),
+				)
+			}
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// invokeAttempt runs an attempt within the per attempt timeout. An attempt
+// stopped by its timeout fails with codes.DeadlineExceeded, which is retried
+// when the policy lists it.
+func invokeAttempt(ctx context.Context, policy RetryPolicy, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if policy.PerAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.PerAttemptTimeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// fitsDeadline reports whether the deadline of ctx leaves time for backoff
+// and another attempt.
+func fitsDeadline(ctx context.Context, backoff, perAttemptTimeout time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return true
+	}
+	need := backoff
+	if perAttemptTimeout > 0 {
+		need += perAttemptTimeout
+	}
+	return time.Until(deadline) > need
+}
@@ -0,0 +1,97 @@
+package dialer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryUnaryClientInterceptor(t *testing.T) {
+	policy := DefaultRetryPolicy
+	policy.InitialBackoff = time.Millisecond
+	retry := NewRetry(policy).
+		WithIdempotent("/payment.Payment/GetOrder").
+		WithMethodPolicy("/payment.Report/*", RetryPolicy{
+			MaxAttempts:       2,
+			InitialBackoff:    time.Millisecond,
+			RetryableCodes:    []codes.Code{codes.DeadlineExceeded},
+			PerAttemptTimeout: 10 * time.Millisecond,
+		})
+	interceptor := RetryUnaryClientInterceptor(retry)
+
+	failing := func(codes ...codes.Code) (grpc.UnaryInvoker, *int) {
+		calls := 0
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			if calls > len(codes) {
+				return nil
+			}
+			return status.Error(codes[calls-1], "failed")
+		}, &calls
+	}
+
+	t.Run("Idempotent", func(t *testing.T) {
+		tracer := mocktracer.New()
+		span := tracer.StartSpan("call")
+		ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+		invoker, calls := failing(codes.Unavailable, codes.Unavailable)
+		require.NoError(t, interceptor(ctx, "/payment.Payment/GetOrder", nil, nil, nil, invoker))
+		require.Equal(t, 3, *calls)
+
+		span.Finish()
+		require.Len(t, tracer.FinishedSpans()[0].Logs(), 2)
+	})
+
+	t.Run("Max attempts", func(t *testing.T) {
+		invoker, calls := failing(codes.Unavailable, codes.Unavailable, codes.Unavailable)
+		err := interceptor(context.Background(), "/payment.Payment/GetOrder", nil, nil, nil, invoker)
+		require.Equal(t, codes.Unavailable, status.Code(err))
+		require.Equal(t, 3, *calls)
+	})
+
+	t.Run("Not idempotent", func(t *testing.T) {
+		invoker, calls := failing(codes.Unavailable)
+		err := interceptor(context.Background(), "/payment.Payment/Pay", nil, nil, nil, invoker)
+		require.Equal(t, codes.Unavailable, status.Code(err))
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("Not retryable code", func(t *testing.T) {
+		invoker, calls := failing(codes.InvalidArgument)
+		err := interceptor(context.Background(), "/payment.Payment/GetOrder", nil, nil, nil, invoker)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("Per attempt timeout", func(t *testing.T) {
+		calls := 0
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			if calls == 1 {
+				<-ctx.Done()
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return nil
+		}
+		require.NoError(t, interceptor(context.Background(), "/payment.Report/Daily", nil, nil, nil, invoker))
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("Caller deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+
+		invoker, calls := failing(codes.DeadlineExceeded)
+		err := interceptor(ctx, "/payment.Report/Daily", nil, nil, nil, invoker)
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		require.Equal(t, 1, *calls, "no time is left for another attempt")
+	})
+}
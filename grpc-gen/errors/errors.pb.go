@@ -64,6 +64,7 @@ const (
 	GeneralErrorCode_OTP_INVALID                    GeneralErrorCode = -9
 	GeneralErrorCode_SEND_REQUEST_TO_ZALO_FAILED    GeneralErrorCode = -10
 	GeneralErrorCode_SEND_REQUEST_TO_ZALOPAY_FAILED GeneralErrorCode = -11
+	GeneralErrorCode_INVALID_ARGUMENT               GeneralErrorCode = -12
 )
 
 var GeneralErrorCode_name = map[int32]string{
@@ -79,6 +80,7 @@ var GeneralErrorCode_name = map[int32]string{
 	-9:  "OTP_INVALID",
 	-10: "SEND_REQUEST_TO_ZALO_FAILED",
 	-11: "SEND_REQUEST_TO_ZALOPAY_FAILED",
+	-12: "INVALID_ARGUMENT",
 }
 
 var GeneralErrorCode_value = map[string]int32{
@@ -94,6 +96,7 @@ var GeneralErrorCode_value = map[string]int32{
 	"OTP_INVALID":                    -9,
 	"SEND_REQUEST_TO_ZALO_FAILED":    -10,
 	"SEND_REQUEST_TO_ZALOPAY_FAILED": -11,
+	"INVALID_ARGUMENT":               -12,
 }
 
 func (x GeneralErrorCode) String() string {
@@ -168,29 +171,30 @@ func init() {
 func init() { proto.RegisterFile("errors.proto", fileDescriptor_24fe73c7f0ddb19c) }
 
 var fileDescriptor_24fe73c7f0ddb19c = []byte{
-	// 381 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0xcb, 0xab, 0xd3, 0x40,
-	0x14, 0xc6, 0x6f, 0x7a, 0x1f, 0xf1, 0x9e, 0xdc, 0x2b, 0xc3, 0x28, 0x97, 0x68, 0x41, 0x8a, 0xab,
-	0x52, 0x69, 0xb3, 0x10, 0xc4, 0xed, 0x98, 0x8c, 0x36, 0xd8, 0x4e, 0xc6, 0x3c, 0xd4, 0x76, 0x13,
-	0xd2, 0x74, 0x88, 0x81, 0x26, 0x53, 0x92, 0xfa, 0x57, 0xbb, 0xf6, 0xfd, 0x24, 0xa9, 0xcd, 0x58,
-	0x70, 0x56, 0xdf, 0x39, 0xbf, 0x6f, 0xce, 0x37, 0x03, 0x07, 0xae, 0x44, 0x55, 0xc9, 0xaa, 0x9e,
-	0x6c, 0x2b, 0xb9, 0x93, 0xf8, 0xba, 0x90, 0x6b, 0xb1, 0xa9, 0x27, 0xfb, 0xe6, 0xc3, 0x39, 0x9c,
-	0xd3, 0x46, 0x61, 0x0c, 0x67, 0xa9, 0x5c, 0x0b, 0x53, 0x1b, 0x68, 0xc3, 0x73, 0xbf, 0xd5, 0xd8,
-	0x04, 0xbd, 0x10, 0x75, 0x9d, 0x64, 0xc2, 0xec, 0x0d, 0xb4, 0xe1, 0xa5, 0x7f, 0x28, 0xf1, 0x0d,
-	0x5c, 0xac, 0x65, 0x91, 0xe4, 0xa5, 0x79, 0xda, 0x82, 0xbf, 0xd5, 0x68, 0x0c, 0x46, 0x3b, 0xce,
-	0x69, 0x4b, 0xac, 0xc3, 0xe9, 0x92, 0xbb, 0xe8, 0x04, 0xdf, 0x82, 0xb3, 0x25, 0x99, 0x79, 0x48,
-	0xc3, 0x06, 0xe8, 0x8d, 0xe2, 0x64, 0x81, 0x7a, 0xa3, 0x0f, 0x3d, 0x40, 0x2f, 0x44, 0x29, 0xaa,
-	0x64, 0xd3, 0x5e, 0xb3, 0x9b, 0x54, 0x03, 0xf4, 0x20, 0xb2, 0x6d, 0x1a, 0x04, 0xe8, 0x04, 0xdf,
-	0x05, 0x3d, 0x62, 0x2f, 0x99, 0xf7, 0x86, 0xa1, 0xdf, 0x87, 0xa3, 0xe1, 0x1b, 0xb8, 0xa4, 0x6f,
-	0x6d, 0xca, 0x43, 0xd7, 0x63, 0xe8, 0x97, 0xea, 0xf7, 0xe1, 0x76, 0x33, 0xdc, 0x75, 0x62, 0x97,
-	0xbd, 0x26, 0x33, 0xd7, 0x41, 0x3f, 0x15, 0xbc, 0x0f, 0xd7, 0x1e, 0x89, 0xc2, 0x69, 0xc7, 0x7e,
-	0x28, 0x66, 0x82, 0xc1, 0x5d, 0xd6, 0x91, 0xef, 0x8a, 0xdc, 0x83, 0xab, 0xe9, 0x9c, 0xd8, 0x1d,
-	0xfa, 0xa6, 0xd0, 0x00, 0xee, 0x10, 0xce, 0xe3, 0xd0, 0x27, 0x2c, 0xf8, 0x27, 0xf2, 0xeb, 0xd1,
-	0x7b, 0xc8, 0xdc, 0x8b, 0x58, 0xd8, 0xc1, 0x2f, 0x47, 0x99, 0x5e, 0xc8, 0x3b, 0xf2, 0x59, 0x91,
-	0x21, 0xf4, 0x03, 0xca, 0x9c, 0xd8, 0xa7, 0xaf, 0x22, 0x1a, 0x84, 0x71, 0xe8, 0xc5, 0xcd, 0xb7,
-	0xe2, 0xe7, 0xc4, 0x9d, 0x51, 0x07, 0x7d, 0x52, 0xce, 0x47, 0xf0, 0xe0, 0x7f, 0x4e, 0x4e, 0x16,
-	0x07, 0xf3, 0xc7, 0xce, 0xfc, 0xec, 0xe9, 0xf2, 0x49, 0x96, 0xef, 0xde, 0xbd, 0x5f, 0x4d, 0x52,
-	0x59, 0x58, 0x99, 0x1c, 0xa7, 0xf9, 0x2e, 0x4f, 0x65, 0x5e, 0xd6, 0x96, 0x52, 0xab, 0xa4, 0x16,
-	0x56, 0x56, 0x6d, 0xd3, 0x71, 0x26, 0x4a, 0x6b, 0xbf, 0x25, 0xab, 0x8b, 0x76, 0x77, 0x1e, 0xff,
-	0x09, 0x00, 0x00, 0xff, 0xff, 0xe0, 0x7a, 0x8c, 0xf7, 0x4b, 0x02, 0x00, 0x00,
+	// 394 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0x5f, 0x6f, 0x94, 0x40,
+	0x14, 0xc5, 0x4b, 0xb7, 0x2d, 0xf6, 0xd2, 0x9a, 0xc9, 0x68, 0x1a, 0xb4, 0xd1, 0x6c, 0x7c, 0xda,
+	0xd4, 0xec, 0xf2, 0x60, 0x62, 0x7c, 0x1d, 0x61, 0x6c, 0x89, 0xcb, 0x30, 0xc2, 0xa0, 0x76, 0x5f,
+	0x08, 0xcb, 0x4e, 0x90, 0xa4, 0x30, 0x0d, 0xac, 0x5f, 0xc2, 0xcf, 0xeb, 0xff, 0xff, 0x81, 0x76,
+	0x19, 0x9b, 0x38, 0x4f, 0xe7, 0xde, 0xdf, 0x99, 0x7b, 0x66, 0x92, 0x0b, 0x07, 0xb2, 0x69, 0x54,
+	0xd3, 0xce, 0x2e, 0x1b, 0xb5, 0x56, 0xf8, 0xb0, 0x52, 0x2b, 0x79, 0xd1, 0xce, 0xae, 0x9a, 0x8f,
+	0x02, 0xd8, 0xa5, 0x9d, 0xc2, 0x18, 0x76, 0x72, 0xb5, 0x92, 0xb6, 0x31, 0x36, 0x26, 0xbb, 0x51,
+	0xaf, 0xb1, 0x0d, 0x66, 0x25, 0xdb, 0x36, 0x2b, 0xa4, 0xbd, 0x3d, 0x36, 0x26, 0xfb, 0xd1, 0xa6,
+	0xc4, 0x47, 0xb0, 0xb7, 0x52, 0x55, 0x56, 0xd6, 0xf6, 0xa8, 0x07, 0xd7, 0xd5, 0xc9, 0x14, 0xac,
+	0x7e, 0x9c, 0xd7, 0x97, 0xd8, 0x84, 0xd1, 0x82, 0xfb, 0x68, 0x0b, 0xdf, 0x82, 0x9d, 0x05, 0x99,
+	0x87, 0xc8, 0xc0, 0x16, 0x98, 0x9d, 0xe2, 0xe4, 0x1c, 0x6d, 0x9f, 0x7c, 0x18, 0x01, 0x3a, 0x95,
+	0xb5, 0x6c, 0xb2, 0x8b, 0xfe, 0x9a, 0xdb, 0xa5, 0x5a, 0x60, 0xc6, 0x89, 0xeb, 0xd2, 0x38, 0x46,
+	0x5b, 0xf8, 0x2e, 0x98, 0x09, 0x7b, 0xc9, 0xc2, 0x37, 0x0c, 0xfd, 0xd9, 0x1c, 0x03, 0x1f, 0xc1,
+	0x3e, 0x7d, 0xeb, 0x52, 0x2e, 0xfc, 0x90, 0xa1, 0xdf, 0xba, 0x7f, 0x0c, 0xb7, 0xbb, 0xe1, 0xbe,
+	0x97, 0xfa, 0xec, 0x35, 0x99, 0xfb, 0x1e, 0xfa, 0xa5, 0xe1, 0x7d, 0x38, 0x0c, 0x49, 0x22, 0xce,
+	0x06, 0xf6, 0x53, 0x33, 0x1b, 0x2c, 0xee, 0xb3, 0x81, 0xfc, 0xd0, 0xe4, 0x1e, 0x1c, 0x9c, 0x05,
+	0xc4, 0x1d, 0xd0, 0x77, 0x8d, 0xc6, 0x70, 0x87, 0x70, 0x9e, 0x8a, 0x88, 0xb0, 0xf8, 0x9f, 0xc8,
+	0x6f, 0x37, 0xde, 0x43, 0x82, 0x30, 0x61, 0x62, 0x80, 0x5f, 0x6f, 0x64, 0x86, 0x82, 0x0f, 0xe4,
+	0x8b, 0x26, 0x13, 0x38, 0x8e, 0x29, 0xf3, 0xd2, 0x88, 0xbe, 0x4a, 0x68, 0x2c, 0x52, 0x11, 0xa6,
+	0xdd, 0xb7, 0xd2, 0x17, 0xc4, 0x9f, 0x53, 0x0f, 0x7d, 0xd6, 0xce, 0xc7, 0xf0, 0xf0, 0x7f, 0x4e,
+	0x4e, 0xce, 0x37, 0xe6, 0x4f, 0xda, 0xfc, 0x00, 0xd0, 0x75, 0x58, 0x4a, 0xa2, 0xd3, 0x24, 0xa0,
+	0x4c, 0xa0, 0x8f, 0x03, 0x7e, 0xfe, 0x6c, 0xf1, 0xb4, 0x28, 0xd7, 0xef, 0xde, 0x2f, 0x67, 0xb9,
+	0xaa, 0x9c, 0x42, 0x4d, 0xf3, 0x72, 0x5d, 0xe6, 0xaa, 0xac, 0x5b, 0x47, 0xab, 0x65, 0xd6, 0x4a,
+	0xa7, 0x68, 0x2e, 0xf3, 0x69, 0x21, 0x6b, 0xe7, 0x6a, 0x89, 0x96, 0x7b, 0xfd, 0x6a, 0x3d, 0xf9,
+	0x3b, 0x00, 0xa4, 0xdb, 0x3b, 0x5a, 0x6a, 0x02, 0x00, 0x00,
 }
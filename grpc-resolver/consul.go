@@ -0,0 +1,299 @@
+// Package grpc_resolver resolves the gRPC dial targets of services registered
+// in Consul:
+//
+//	consul://payment?tag=v2&healthy=true&dc=dc1
+//	consul:///payment?tag=v2&healthy=true&dc=dc1
+//
+// The service is the path of the target, or else its authority; the Consul
+// client given to the builder is used. Without the healthy parameter only the
+// instances passing their checks are resolved; tag may be repeated.
+//
+// grpc only splits the scheme off a target with a path, it passes
+// consul://payment?tag=v2 to its default scheme: dial it with the
+// DialOption of the builder, which also stands in for the default scheme.
+package grpc_resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+)
+
+const (
+	// ConsulScheme is the scheme of the targets resolved by Consul.
+	ConsulScheme = "consul"
+
+	// DefaultServiceConfig balances the calls over the resolved addresses.
+	DefaultServiceConfig = `{"loadBalancingPolicy":"round_robin"}`
+
+	// DefaultWaitTime bounds a blocking query on the service.
+	DefaultWaitTime = 5 * time.Minute
+	// DefaultRetryInterval is how long the resolver waits after a Consul error.
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// ConsulTarget returns the dial target of a service, resolving the instances
+// with all of tags which pass their health checks.
+func ConsulTarget(service string, tags ...string) string {
+	target := ConsulScheme + ":///" + service
+	if len(tags) > 0 {
+		query := url.Values{"tag": tags}
+		target += "?" + query.Encode()
+	}
+	return target
+}
+
+// NewConsulBuilder returns a builder of the consul scheme. Pass its
+// DialOption to grpc.Dial, or the builder to resolver.Register to resolve
+// the consul:/// targets of every dial.
+func NewConsulBuilder(client *consul.Client, logger log.Factory) *ConsulBuilder {
+	return &ConsulBuilder{
+		client:        client,
+		logger:        logger,
+		waitTime:      DefaultWaitTime,
+		retryInterval: DefaultRetryInterval,
+	}
+}
+
+// ConsulBuilder builds the resolvers of the consul scheme.
+type ConsulBuilder struct {
+	client        *consul.Client
+	logger        log.Factory
+	waitTime      time.Duration
+	retryInterval time.Duration
+}
+
+// WithWaitTime ...
+func (b *ConsulBuilder) WithWaitTime(waitTime time.Duration) *ConsulBuilder {
+	b.waitTime = waitTime
+	return b
+}
+
+// WithRetryInterval ...
+func (b *ConsulBuilder) WithRetryInterval(interval time.Duration) *ConsulBuilder {
+	b.retryInterval = interval
+	return b
+}
+
+// DialOption resolves the consul targets of a dial, including those which grpc
+// passes to the default scheme.
+func (b *ConsulBuilder) DialOption() grpc.DialOption {
+	return grpc.WithResolvers(b, &defaultBuilder{consul: b, scheme: resolver.GetDefaultScheme()})
+}
+
+// Scheme implements resolver.Builder
+func (b *ConsulBuilder) Scheme() string {
+	return ConsulScheme
+}
+
+// Build implements resolver.Builder
+func (b *ConsulBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	q, err := parseConsulTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &consulResolver{
+		builder: b,
+		query:   q,
+		cc:      cc,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		resolve: make(chan struct{}, 1),
+	}
+	if !opts.DisableServiceConfig {
+		r.serviceConfig = cc.ParseServiceConfig(DefaultServiceConfig)
+	}
+
+	go r.watch(ctx)
+	return r, nil
+}
+
+// consulQuery is the parsed endpoint of a target.
+type consulQuery struct {
+	service     string
+	tags        []string
+	passingOnly bool
+	datacenter  string
+}
+
+// parseConsulTarget parses a target split by grpc, or passed whole to the
+// default scheme.
+func parseConsulTarget(target resolver.Target) (consulQuery, error) {
+	raw := target.Endpoint
+	if target.Scheme == ConsulScheme {
+		raw = ConsulScheme + "://" + target.Authority + "/" + target.Endpoint
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return consulQuery{}, fmt.Errorf("grpc_resolver: invalid consul target %q: %v", raw, err)
+	}
+	if u.Scheme != ConsulScheme {
+		return consulQuery{}, fmt.Errorf("grpc_resolver: %q is not a consul target", raw)
+	}
+
+	q := consulQuery{
+		service:     strings.Trim(u.Path, "/"),
+		tags:        u.Query()["tag"],
+		passingOnly: true,
+		datacenter:  u.Query().Get("dc"),
+	}
+	if q.service == "" {
+		q.service = u.Host
+	}
+	if q.service == "" {
+		return consulQuery{}, fmt.Errorf("grpc_resolver: consul target %q has no service", raw)
+	}
+	if healthy := u.Query().Get("healthy"); healthy != "" {
+		if q.passingOnly, err = strconv.ParseBool(healthy); err != nil {
+			return consulQuery{}, fmt.Errorf("grpc_resolver: invalid healthy parameter %q", healthy)
+		}
+	}
+	return q, nil
+}
+
+// defaultBuilder stands in for the default scheme of a dial, building the
+// consul targets grpc could not split and delegating the others.
+type defaultBuilder struct {
+	consul *ConsulBuilder
+	scheme string
+}
+
+func (b *defaultBuilder) Scheme() string {
+	return b.scheme
+}
+
+func (b *defaultBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	if strings.HasPrefix(target.Endpoint, ConsulScheme+"://") {
+		return b.consul.Build(target, cc, opts)
+	}
+	builder := resolver.Get(b.scheme)
+	if builder == nil {
+		return nil, fmt.Errorf("grpc_resolver: no resolver of the default scheme %q", b.scheme)
+	}
+	return builder.Build(target, cc, opts)
+}
+
+type consulResolver struct {
+	builder       *ConsulBuilder
+	query         consulQuery
+	cc            resolver.ClientConn
+	serviceConfig *serviceconfig.ParseResult
+
+	cancel  context.CancelFunc
+	done    chan struct{}
+	resolve chan struct{}
+}
+
+// ResolveNow implements resolver.Resolver. The addresses are pushed as soon
+// as they change, it only cuts short the wait after an error.
+func (r *consulResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolve <- struct{}{}:
+	default:
+	}
+}
+
+// Close implements resolver.Resolver
+func (r *consulResolver) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *consulResolver) watch(ctx context.Context) {
+	defer close(r.done)
+
+	// the connection keeps the last known addresses
+	r.builder.watch(ctx, r.query, func(entries []*consul.ServiceEntry) {
+		r.cc.UpdateState(resolver.State{
+			Addresses:     consulAddresses(entries),
+			ServiceConfig: r.serviceConfig,
+		})
+	}, r.cc.ReportError, r.resolve)
+}
+
+// Watch pushes the entries of the instances of service with all of tags
+// passing their checks to update each time they change, until ctx is done.
+// The Consul errors are logged and the query retried.
+func (b *ConsulBuilder) Watch(ctx context.Context, service string, tags []string, update func(entries []*consul.ServiceEntry)) {
+	b.watch(ctx, consulQuery{service: service, tags: tags, passingOnly: true}, update, func(error) {}, nil)
+}
+
+// watch runs the blocking queries of q until ctx is done. The errors before
+// the first update are passed to fail, the query is retried after the retry
+// interval or when retry receives.
+func (b *ConsulBuilder) watch(ctx context.Context, q consulQuery, update func(entries []*consul.ServiceEntry), fail func(err error), retry <-chan struct{}) {
+	var (
+		index    uint64
+		resolved bool
+	)
+	for {
+		entries, meta, err := b.client.Health().ServiceMultipleTags(q.service, q.tags, q.passingOnly, (&consul.QueryOptions{
+			Datacenter: q.datacenter,
+			WaitIndex:  index,
+			WaitTime:   b.waitTime,
+		}).WithContext(ctx))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			b.logger.Bg().Error("Resolve service from consul",
+				zap.String("service", q.service), zap.Error(err))
+			if !resolved {
+				fail(err)
+			}
+
+			index = 0
+			select {
+			case <-ctx.Done():
+				return
+			case <-retry:
+			case <-time.After(b.retryInterval):
+			}
+			continue
+		}
+
+		if meta.LastIndex == index && resolved {
+			// the wait time elapsed without change
+			continue
+		}
+		if meta.LastIndex < index {
+			// the index went backwards, e.g. after a Consul restart
+			index = 0
+		} else {
+			index = meta.LastIndex
+		}
+		resolved = true
+		update(entries)
+	}
+}
+
+// consulAddresses returns the addresses of entries, the service address or
+// else the node address, with the metadata of the services.
+func consulAddresses(entries []*consul.ServiceEntry) []resolver.Address {
+	addrs := make([]resolver.Address, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, resolver.Address{
+			Addr:     net.JoinHostPort(host, strconv.Itoa(e.Service.Port)),
+			Metadata: ParseMetadata(e.Service.Meta),
+		})
+	}
+	return addrs
+}
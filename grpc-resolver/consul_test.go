@@ -0,0 +1,214 @@
+package grpc_resolver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// fakeHealth serves the health of a service with blocking queries.
+type fakeHealth struct {
+	mu      sync.Mutex
+	entries []*consul.ServiceEntry
+	index   uint64
+	healthy bool
+	queries []string
+}
+
+func (h *fakeHealth) set(entries ...*consul.ServiceEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = entries
+	h.index++
+}
+
+func (h *fakeHealth) setHealthy(healthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.healthy = healthy
+}
+
+func (h *fakeHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	deadline := time.Now().Add(time.Second)
+	for {
+		h.mu.Lock()
+		if !h.healthy {
+			h.mu.Unlock()
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if wait == 0 || h.index > wait || time.Now().After(deadline) {
+			break
+		}
+		h.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer h.mu.Unlock()
+
+	h.queries = append(h.queries, r.URL.RequestURI())
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(h.index, 10))
+	json.NewEncoder(w).Encode(h.entries)
+}
+
+func newClient(t *testing.T, addr string) *consul.Client {
+	cfg := consul.DefaultConfig()
+	cfg.Address = addr
+	client, err := consul.NewClient(cfg)
+	require.NoError(t, err)
+	return client
+}
+
+func entry(addr string, port int) *consul.ServiceEntry {
+	return &consul.ServiceEntry{
+		Node:    &consul.Node{Address: "10.0.0.1"},
+		Service: &consul.AgentService{Address: addr, Port: port},
+	}
+}
+
+// fakeClientConn records the states pushed by the resolver.
+type fakeClientConn struct {
+	resolver.ClientConn
+
+	states chan resolver.State
+	errors chan error
+}
+
+func (cc *fakeClientConn) UpdateState(state resolver.State) {
+	cc.states <- state
+}
+
+func (cc *fakeClientConn) ReportError(err error) {
+	cc.errors <- err
+}
+
+func (cc *fakeClientConn) ParseServiceConfig(serviceConfigJSON string) *serviceconfig.ParseResult {
+	return &serviceconfig.ParseResult{}
+}
+
+func addrs(state resolver.State) []string {
+	var addrs []string
+	for _, a := range state.Addresses {
+		addrs = append(addrs, a.Addr)
+	}
+	return addrs
+}
+
+func TestConsulResolver(t *testing.T) {
+	health := &fakeHealth{healthy: true}
+	health.set(entry("10.0.0.2", 9000), entry("", 9001))
+	srv := httptest.NewServer(health)
+	defer srv.Close()
+
+	client := newClient(t, srv.URL)
+
+	builder := NewConsulBuilder(client, log.NewFactory(zap.NewNop())).WithRetryInterval(10 * time.Millisecond)
+	cc := &fakeClientConn{states: make(chan resolver.State, 10), errors: make(chan error, 10)}
+	r, err := builder.Build(resolver.Target{Scheme: ConsulScheme, Endpoint: "payment?tag=v2"}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	state := <-cc.states
+	require.Equal(t, []string{"10.0.0.2:9000", "10.0.0.1:9001"}, addrs(state))
+	require.NotNil(t, state.ServiceConfig)
+
+	health.setHealthy(false)
+	time.Sleep(50 * time.Millisecond)
+	require.Len(t, cc.states, 0, "the last known addresses are kept")
+	require.Len(t, cc.errors, 0)
+
+	health.set(entry("10.0.0.3", 9000))
+	health.setHealthy(true)
+	state = <-cc.states
+	require.Equal(t, []string{"10.0.0.3:9000"}, addrs(state))
+
+	health.mu.Lock()
+	require.Contains(t, health.queries[0], "tag=v2")
+	require.Contains(t, health.queries[0], "passing=1")
+	health.mu.Unlock()
+}
+
+func TestConsulBuilder_dial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(ln)
+	defer server.Stop()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	consulHealth := &fakeHealth{healthy: true}
+	consulHealth.set(entry("127.0.0.1", port))
+	srv := httptest.NewServer(consulHealth)
+	defer srv.Close()
+
+	client := newClient(t, srv.URL)
+	builder := NewConsulBuilder(client, log.NewFactory(zap.NewNop()))
+
+	for _, target := range []string{
+		"consul://payment?tag=x&healthy=true",
+		"consul:///payment?tag=x&healthy=true",
+		ConsulTarget("payment", "x"),
+	} {
+		t.Run(target, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			conn, err := grpc.DialContext(ctx, target, grpc.WithInsecure(), grpc.WithBlock(), builder.DialOption())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+			require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+		})
+	}
+
+	consulHealth.mu.Lock()
+	defer consulHealth.mu.Unlock()
+	for _, query := range consulHealth.queries {
+		require.Contains(t, query, "tag=x")
+	}
+	require.Contains(t, consulHealth.queries[0], "/v1/health/service/payment?")
+}
+
+func TestParseConsulTarget(t *testing.T) {
+	q, err := parseConsulTarget(resolver.Target{Scheme: ConsulScheme, Endpoint: "payment?tag=a&tag=b&healthy=false&dc=dc2"})
+	require.NoError(t, err)
+	require.Equal(t, consulQuery{service: "payment", tags: []string{"a", "b"}, datacenter: "dc2"}, q)
+
+	q, err = parseConsulTarget(resolver.Target{Scheme: ConsulScheme, Endpoint: ConsulTarget("payment", "v2")[len(ConsulScheme+":///"):]})
+	require.NoError(t, err)
+	require.Equal(t, consulQuery{service: "payment", tags: []string{"v2"}, passingOnly: true}, q)
+
+	// the service given as the authority
+	q, err = parseConsulTarget(resolver.Target{Scheme: ConsulScheme, Authority: "payment", Endpoint: "?tag=v2"})
+	require.NoError(t, err)
+	require.Equal(t, consulQuery{service: "payment", tags: []string{"v2"}, passingOnly: true}, q)
+
+	// passed whole to the default scheme
+	q, err = parseConsulTarget(resolver.Target{Scheme: "passthrough", Endpoint: "consul://payment?tag=v2&healthy=true"})
+	require.NoError(t, err)
+	require.Equal(t, consulQuery{service: "payment", tags: []string{"v2"}, passingOnly: true}, q)
+
+	_, err = parseConsulTarget(resolver.Target{Scheme: ConsulScheme, Endpoint: "?tag=a"})
+	require.Error(t, err)
+	_, err = parseConsulTarget(resolver.Target{Scheme: "passthrough", Endpoint: "payment:9000"})
+	require.Error(t, err)
+}
@@ -0,0 +1,75 @@
+package grpc_resolver
+
+import (
+	"strconv"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Keys of the service metadata registered with an instance.
+const (
+	MetaZone    = "zone"
+	MetaWeight  = "weight"
+	MetaVersion = "version"
+	MetaCanary  = "canary"
+)
+
+// Metadata describes an instance to the balancer. The resolvers set it as
+// the Metadata of the resolved addresses.
+type Metadata struct {
+	Zone string
+	// Weight is the share of the calls sent to the instance relative to the
+	// others. Map registers the default weight 1 when it is 0.
+	Weight  int
+	Version string
+	Canary  bool
+	// Drained registers the instance with weight 0, so it receives calls only
+	// when no other instance can take them.
+	Drained bool
+}
+
+// ParseMetadata reads the metadata of an instance from its service metadata.
+// The weight defaults to 1, a weight of 0 drains the instance.
+func ParseMetadata(meta map[string]string) Metadata {
+	md := Metadata{
+		Zone:    meta[MetaZone],
+		Weight:  1,
+		Version: meta[MetaVersion],
+	}
+	if weight, err := strconv.Atoi(meta[MetaWeight]); err == nil && weight >= 0 {
+		md.Weight = weight
+		md.Drained = weight == 0
+	}
+	md.Canary, _ = strconv.ParseBool(meta[MetaCanary])
+	return md
+}
+
+// Map returns the service metadata to register with an instance.
+func (md Metadata) Map() map[string]string {
+	meta := make(map[string]string)
+	switch {
+	case md.Drained:
+		meta[MetaWeight] = "0"
+	case md.Weight > 0:
+		meta[MetaWeight] = strconv.Itoa(md.Weight)
+	}
+	if md.Zone != "" {
+		meta[MetaZone] = md.Zone
+	}
+	if md.Version != "" {
+		meta[MetaVersion] = md.Version
+	}
+	if md.Canary {
+		meta[MetaCanary] = "true"
+	}
+	return meta
+}
+
+// AddressMetadata returns the metadata of addr, the default one when the
+// resolver set none.
+func AddressMetadata(addr resolver.Address) Metadata {
+	if md, ok := addr.Metadata.(Metadata); ok {
+		return md
+	}
+	return Metadata{Weight: 1}
+}
@@ -0,0 +1,16 @@
+package grpc_resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata(t *testing.T) {
+	require.Equal(t, map[string]string{MetaZone: "a"}, Metadata{Zone: "a"}.Map(), "default weight")
+	require.Equal(t, 1, ParseMetadata(Metadata{Zone: "a"}.Map()).Weight)
+
+	drained := Metadata{Zone: "a", Drained: true}
+	require.Equal(t, "0", drained.Map()[MetaWeight])
+	require.Equal(t, Metadata{Zone: "a", Drained: true}, ParseMetadata(drained.Map()))
+}
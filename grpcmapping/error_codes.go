@@ -0,0 +1,51 @@
+package grpcmapping
+
+import (
+	"strings"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/grpc-gen/errors"
+)
+
+const (
+	// CodeSuccess ...
+	CodeSuccess = errors.GeneralErrorCode_SUCCESS
+	// CodeUnknown ...
+	CodeUnknown = errors.GeneralErrorCode_UNKNOWN
+	// CodeException ...
+	CodeException = errors.GeneralErrorCode_EXCEPTION
+	// CodeUnauthenticated ...
+	CodeUnauthenticated = errors.GeneralErrorCode_OAUTH_INVALID
+	// CodeInvalidArgument is returned for requests failing validation.
+	CodeInvalidArgument = errors.GeneralErrorCode_INVALID_ARGUMENT
+)
+
+var messages = map[errors.GeneralErrorCode]string{
+	errors.GeneralErrorCode_SUCCESS:                        "Success",
+	errors.GeneralErrorCode_UNKNOWN:                        "The system is busy, please try again later",
+	errors.GeneralErrorCode_EXCEPTION:                      "The system is busy, please try again later",
+	errors.GeneralErrorCode_ZALOID_INVALID:                 "Invalid Zalo ID",
+	errors.GeneralErrorCode_OAUTH_INVALID:                  "Unauthenticated",
+	errors.GeneralErrorCode_PIN_INVALID:                    "Invalid PIN",
+	errors.GeneralErrorCode_HMAC_INVALID:                   "Invalid signature",
+	errors.GeneralErrorCode_APP_TRANSID_INVALID:            "Invalid app transaction ID",
+	errors.GeneralErrorCode_AMOUNT_INVALID:                 "Invalid amount",
+	errors.GeneralErrorCode_OTP_INVALID:                    "Invalid OTP",
+	errors.GeneralErrorCode_SEND_REQUEST_TO_ZALO_FAILED:    "Send request to Zalo failed",
+	errors.GeneralErrorCode_SEND_REQUEST_TO_ZALOPAY_FAILED: "Send request to ZaloPay failed",
+	errors.GeneralErrorCode_INVALID_ARGUMENT:               "Invalid argument",
+}
+
+// ErrorDomain returns the value used in the domain field of an errors.Error.
+func ErrorDomain(domain errors.ErrorDomain) string {
+	return strings.ToLower(domain.String())
+}
+
+// NewErrorDetail returns an errors.Error of the ZPI domain for the given code
+// with its default message.
+func NewErrorDetail(code errors.GeneralErrorCode) *errors.Error {
+	return &errors.Error{
+		Code:    int32(code),
+		Message: messages[code],
+		Domain:  ErrorDomain(errors.ErrorDomain_ZPI),
+	}
+}
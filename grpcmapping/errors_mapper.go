@@ -7,6 +7,7 @@ import (
 
 	"github.com/richard-xtek/go-grpc-micro-kit/grpc-gen/errors"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/grpclog"
@@ -14,7 +15,21 @@ import (
 )
 
 type responseBody struct {
-	Error *errors.Error `json:"error"`
+	Error *errorBody `json:"error"`
+}
+
+// errorBody is an errors.Error with the field violations of invalid requests:
+//
+//	{"error": {"code": -12, "message": "Invalid argument", "domain": "zpi",
+//	  "fields": [{"field": "phone", "description": "..."}]}}
+type errorBody struct {
+	*errors.Error
+	Fields []fieldViolation `json:"fields,omitempty"`
+}
+
+type fieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
 }
 
 // NewError return an error
@@ -44,7 +59,7 @@ func TransformErrors(ctx context.Context, mux *runtime.ServeMux, marshaler runti
 	w.Header().Set("Content-Type", contentType)
 
 	// Transform to API error structure
-	body := responseFromGrpcCode(ctx, s.Code())
+	body := responseFromStatus(s)
 	// Log if get unknown error
 	switch body.Error.GetCode() {
 	case int32(errors.GeneralErrorCode_AMOUNT_INVALID):
@@ -75,19 +90,49 @@ func TransformErrors(ctx context.Context, mux *runtime.ServeMux, marshaler runti
 	// handleForwardResponseTrailer(w, md)
 }
 
-func responseFromGrpcCode(ctx context.Context, code codes.Code) responseBody {
+// responseFromStatus prefers the errors.Error carried in the status details,
+// falling back to the status code, and adds the field violations of an
+// errdetails.BadRequest detail.
+func responseFromStatus(s *status.Status) responseBody {
+	body := responseBody{}
+	var fields []fieldViolation
+	for _, detail := range s.Details() {
+		switch d := detail.(type) {
+		case *errors.Error:
+			if body.Error == nil {
+				body.Error = &errorBody{Error: d}
+			}
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				fields = append(fields, fieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		}
+	}
+	if body.Error == nil {
+		body = responseFromGrpcCode(s.Code())
+	}
+	body.Error.Fields = fields
+
+	return body
+}
+
+func responseFromGrpcCode(code codes.Code) responseBody {
 	var err *errors.Error
 
 	switch code {
 	case codes.OK:
-		err = errors.NewInternalError(ctx, errors.CodeSuccess)
+		err = NewErrorDetail(CodeSuccess)
 	case codes.Unauthenticated:
-		err = errors.NewInternalError(ctx, errors.CodeUnauthenticated)
+		err = NewErrorDetail(CodeUnauthenticated)
+	case codes.Internal:
+		err = NewErrorDetail(CodeException)
+	case codes.InvalidArgument:
+		err = NewErrorDetail(CodeInvalidArgument)
 	default:
-		err = errors.NewInternalError(ctx, errors.CodeUnknown)
+		err = NewErrorDetail(CodeUnknown)
 	}
 
 	return responseBody{
-		Error: err,
+		Error: &errorBody{Error: err},
 	}
 }
@@ -0,0 +1,27 @@
+package grpcmapping
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTransformErrors(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "invalid").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "phone", Description: "invalid phone"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/users", nil)
+	TransformErrors(context.Background(), runtime.NewServeMux(), &runtime.JSONPb{}, w, r, st.Err())
+
+	require.JSONEq(t, `{"error": {"code": -12, "message": "Invalid argument", "domain": "zpi",
+		"fields": [{"field": "phone", "description": "invalid phone"}]}}`, w.Body.String())
+}
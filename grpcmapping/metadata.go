@@ -3,10 +3,24 @@ package grpcmapping
 import (
 	"context"
 	"net/http"
+	"strings"
 
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/richard-xtek/go-grpc-micro-kit/auth/requestinfo"
 	"google.golang.org/grpc/metadata"
 )
 
+// IncomingHeaderMatcher forwards the headers like runtime.DefaultHeaderMatcher
+// except the keys set by the calling services only, which the clients of the
+// gateway could forge, see requestinfo.IsServiceKey.
+func IncomingHeaderMatcher(key string) (string, bool) {
+	key, ok := runtime.DefaultHeaderMatcher(key)
+	if !ok || requestinfo.IsServiceKey(strings.ToLower(key)) {
+		return "", false
+	}
+	return key, true
+}
+
 // AppendRequestMetadata append cookies and headers to incoming context
 func AppendRequestMetadata(ctx context.Context, req *http.Request) metadata.MD {
 	md := metadata.MD{}
@@ -14,6 +28,9 @@ func AppendRequestMetadata(ctx context.Context, req *http.Request) metadata.MD {
 	// Append cookies
 	cookies := req.Cookies()
 	for _, cookie := range cookies {
+		if requestinfo.IsServiceKey(strings.ToLower(cookie.Name)) {
+			continue
+		}
 		md.Append(cookie.Name, cookie.Value)
 	}
 
@@ -21,5 +38,10 @@ func AppendRequestMetadata(ctx context.Context, req *http.Request) metadata.MD {
 	clientIP := GetClientIP(req)
 	md.Append("x-client-ip", clientIP)
 
+	// Append idempotency key
+	if key := req.Header.Get("Idempotency-Key"); key != "" {
+		md.Append("idempotency-key", key)
+	}
+
 	return md
 }
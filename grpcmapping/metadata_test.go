@@ -0,0 +1,35 @@
+package grpcmapping
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncomingHeaderMatcher(t *testing.T) {
+	key, ok := IncomingHeaderMatcher("Grpc-Metadata-Trace-Id")
+	require.True(t, ok)
+	require.Equal(t, "Trace-Id", key)
+
+	key, ok = IncomingHeaderMatcher("User-Agent")
+	require.True(t, ok)
+	require.Equal(t, "grpcgateway-User-Agent", key)
+
+	_, ok = IncomingHeaderMatcher("Grpc-Metadata-Grpcgateway-Provider-Id")
+	require.False(t, ok, "set by the calling services only")
+	_, ok = IncomingHeaderMatcher("Grpc-Metadata-Grpcgateway-Claim-User-Id")
+	require.False(t, ok)
+}
+
+func TestAppendRequestMetadata(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	r.AddCookie(&http.Cookie{Name: "grpcgateway-provider-id", Value: "p1"})
+
+	md := AppendRequestMetadata(context.Background(), r)
+	require.Equal(t, []string{"s1"}, md["session"])
+	require.NotContains(t, md, "grpcgateway-provider-id")
+}
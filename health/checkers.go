@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/richard-xtek/go-grpc-micro-kit/kafka"
+	"github.com/richard-xtek/go-grpc-micro-kit/redis"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// RedisChecker checks that the redis store answers PING. The store must
+// implement redis.Pinger, otherwise the check always fails. The check fails
+// when ctx is done before redis answers.
+func RedisChecker(store redis.Store) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		pinger, ok := store.(redis.Pinger)
+		if !ok {
+			return fmt.Errorf("redis store %T does not implement redis.Pinger", store)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- pinger.Ping()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// GormChecker checks that the database behind db is reachable.
+func GormChecker(db *gorm.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.DB().PingContext(ctx)
+	})
+}
+
+// KafkaPublisherChecker checks that the publisher is open and a broker is reachable.
+func KafkaPublisherChecker(publisher *kafka.Publisher) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return publisher.Ping()
+	})
+}
+
+// GRPCConnChecker checks that a downstream connection is not failing or shut down.
+func GRPCConnChecker(conn *grpc.ClientConn) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		switch state := conn.GetState(); state {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("connection to %s is %s", conn.Target(), state)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,261 @@
+// Package health implements the standard grpc.health.v1 service and derives
+// the serving status of each service from pluggable dependency checkers.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"go.uber.org/zap"
+	grpc_health "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// DefaultInterval is how often the registered checkers are run.
+	DefaultInterval = 10 * time.Second
+
+	// DefaultTimeout bounds a single run of a checker.
+	DefaultTimeout = 3 * time.Second
+)
+
+// Checker reports whether a dependency is usable. A nil error means healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is an adapter to allow the use of ordinary functions as Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type checkOptions struct {
+	critical bool
+	services []string
+}
+
+// CheckOption configures how a checker affects serving status.
+type CheckOption func(*checkOptions)
+
+// Critical marks the dependency as critical: when it fails, the services it
+// applies to are reported as NOT_SERVING.
+func Critical() CheckOption {
+	return func(o *checkOptions) {
+		o.critical = true
+	}
+}
+
+// ForServices restricts the checker to the given gRPC service names. By
+// default a checker applies to every service.
+func ForServices(services ...string) CheckOption {
+	return func(o *checkOptions) {
+		o.services = append(o.services, services...)
+	}
+}
+
+type check struct {
+	name    string
+	checker Checker
+	checkOptions
+}
+
+func (c *check) appliesTo(service string) bool {
+	if len(c.services) == 0 || service == "" {
+		return true
+	}
+	for _, s := range c.services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is the outcome of the last run of a checker.
+type Result struct {
+	Critical  bool
+	Err       error
+	CheckedAt time.Time
+}
+
+// Server implements grpc.health.v1.Health. Watch streams receive an update
+// whenever the status of the watched service changes.
+type Server struct {
+	*grpc_health.Server
+
+	logger   log.Factory
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.RWMutex
+	services map[string]struct{}
+	checks   []*check
+	results  map[string]Result
+	shutdown bool
+	quit     chan struct{}
+}
+
+// NewServer ...
+func NewServer(logger log.Factory) *Server {
+	return &Server{
+		Server:   grpc_health.NewServer(),
+		logger:   logger,
+		interval: DefaultInterval,
+		timeout:  DefaultTimeout,
+		services: make(map[string]struct{}),
+		results:  make(map[string]Result),
+		quit:     make(chan struct{}),
+	}
+}
+
+// WithInterval ...
+func (s *Server) WithInterval(interval time.Duration) *Server {
+	s.interval = interval
+	return s
+}
+
+// WithTimeout ...
+func (s *Server) WithTimeout(timeout time.Duration) *Server {
+	s.timeout = timeout
+	return s
+}
+
+// AddService declares services whose status is reported by the server.
+func (s *Server) AddService(services ...string) {
+	s.mu.Lock()
+	for _, service := range services {
+		s.services[service] = struct{}{}
+	}
+	s.mu.Unlock()
+}
+
+// Register adds a dependency checker under the given name.
+func (s *Server) Register(name string, checker Checker, opts ...CheckOption) {
+	c := &check{name: name, checker: checker}
+	for _, opt := range opts {
+		opt(&c.checkOptions)
+	}
+
+	s.mu.Lock()
+	s.checks = append(s.checks, c)
+	s.mu.Unlock()
+}
+
+// Results returns the outcome of the last run of every checker keyed by name.
+func (s *Server) Results() map[string]Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make(map[string]Result, len(s.results))
+	for name, r := range s.results {
+		results[name] = r
+	}
+	return results
+}
+
+// Start runs the checkers once synchronously, then periodically in the
+// background until Shutdown is called. Starting again after Shutdown resumes
+// status reporting.
+func (s *Server) Start() {
+	s.mu.Lock()
+	if s.shutdown {
+		s.shutdown = false
+		s.quit = make(chan struct{})
+		s.Server.Resume()
+	}
+	quit := s.quit
+	s.mu.Unlock()
+
+	s.Evaluate(context.Background())
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.Evaluate(context.Background())
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// Evaluate runs every checker and updates the serving status of each service.
+func (s *Server) Evaluate(ctx context.Context) {
+	s.mu.RLock()
+	checks := make([]*check, len(s.checks))
+	copy(checks, s.checks)
+	s.mu.RUnlock()
+
+	failed := make(map[*check]bool)
+	results := make(map[string]Result, len(checks))
+	for _, c := range checks {
+		err := s.run(ctx, c)
+		if err != nil {
+			failed[c] = true
+			s.logger.Bg().Warn("Health check failed", zap.String("check", c.name), zap.Bool("critical", c.critical), zap.Error(err))
+		}
+		results[c.name] = Result{Critical: c.critical, Err: err, CheckedAt: time.Now()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = results
+	if s.shutdown {
+		return
+	}
+
+	services := []string{""}
+	for service := range s.services {
+		services = append(services, service)
+	}
+	for _, service := range services {
+		status := healthpb.HealthCheckResponse_SERVING
+		for c := range failed {
+			if c.critical && c.appliesTo(service) {
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+				break
+			}
+		}
+		s.SetServingStatus(service, status)
+	}
+}
+
+func (s *Server) run(ctx context.Context, c *check) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.checker.Check(ctx)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Shutdown stops the periodic checks and sets every service to NOT_SERVING.
+// The status no longer changes after Shutdown.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	if !s.shutdown {
+		s.shutdown = true
+		close(s.quit)
+	}
+	s.mu.Unlock()
+
+	s.Server.Shutdown()
+}
@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/redis"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func status(t *testing.T, s *Server, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func TestServer_Evaluate(t *testing.T) {
+	var dbErr, cacheErr error
+	s := NewServer(log.NewFactory(zap.NewNop()))
+	s.AddService("foo.Foo", "bar.Bar")
+	s.Register("db", CheckerFunc(func(ctx context.Context) error { return dbErr }), Critical(), ForServices("foo.Foo"))
+	s.Register("cache", CheckerFunc(func(ctx context.Context) error { return cacheErr }))
+
+	t.Run("All healthy", func(t *testing.T) {
+		s.Evaluate(context.Background())
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, s, ""))
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, s, "foo.Foo"))
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, s, "bar.Bar"))
+	})
+
+	t.Run("Non critical failure", func(t *testing.T) {
+		cacheErr = errors.New("cache down")
+		s.Evaluate(context.Background())
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, s, "foo.Foo"))
+		require.Error(t, s.Results()["cache"].Err)
+	})
+
+	t.Run("Critical failure", func(t *testing.T) {
+		dbErr = errors.New("db down")
+		s.Evaluate(context.Background())
+		require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, s, ""))
+		require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, s, "foo.Foo"))
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, status(t, s, "bar.Bar"))
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		dbErr, cacheErr = nil, nil
+		s.Shutdown()
+		s.Evaluate(context.Background())
+		require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(t, s, "bar.Bar"))
+	})
+}
+
+// hungRedis answers PING once release is closed.
+type hungRedis struct {
+	redis.Store
+	release chan struct{}
+}
+
+func (r hungRedis) Ping() error {
+	<-r.release
+	return nil
+}
+
+func TestRedisChecker(t *testing.T) {
+	store := hungRedis{release: make(chan struct{})}
+	defer close(store.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, RedisChecker(store).Check(ctx))
+}
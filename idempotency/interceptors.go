@@ -0,0 +1,253 @@
+// Package idempotency replays the result of unary RPCs retried with the same
+// idempotency key. The first call with a key takes a lock in redis, runs, and
+// stores its response and status under the key; later calls with the key get
+// the stored result. Duplicates arriving while the first call is still in
+// flight get codes.Aborted, and calls reusing a key with a different request
+// get codes.InvalidArgument.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/redis"
+)
+
+// result is the stored outcome of a call.
+type result struct {
+	Status       []byte `json:"status"`
+	ResponseType string `json:"response_type,omitempty"`
+	Response     []byte `json:"response,omitempty"`
+	RequestHash  string `json:"request_hash,omitempty"`
+}
+
+// Store is the part of redis.Store used to keep the locks and results, as
+// implemented by the Client returned by redis.New.
+type Store interface {
+	redis.Locker
+	GetString(k string) (string, error)
+	SetStringWithTTL(k string, v string, ttl int) error
+}
+
+// UnaryServerInterceptor makes the calls carrying an idempotency key, by
+// default in the idempotency-key metadata, idempotent. Calls without a key
+// run normally.
+func UnaryServerInterceptor(store Store, opts ...Option) grpc.UnaryServerInterceptor {
+	o := evaluateOpt(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := o.keyFunc(ctx, info.FullMethod, req)
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		resultKey := o.keyPrefix + info.FullMethod + ":" + key
+		lockKey := resultKey + ":lock"
+		hash := requestHash(req)
+
+		if r, ok := replay(store, resultKey); ok {
+			return r.forRequest(key, hash)
+		}
+
+		token := lockToken(hash)
+		locked, err := store.SetStringNX(lockKey, token, seconds(o.lockTTL))
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "idempotency: lock %s: %v", key, err)
+		}
+		if !locked {
+			// the first call may have finished in between
+			if r, ok := replay(store, resultKey); ok {
+				return r.forRequest(key, hash)
+			}
+			if owner, _ := store.GetString(lockKey); owner != "" && lockHash(owner) != hash {
+				return nil, errRequestMismatch(key)
+			}
+			return nil, status.Errorf(codes.Aborted, "idempotency: a call with key %s is in progress", key)
+		}
+
+		stop := keepLock(store, lockKey, token, o.lockTTL)
+		resp, err := handler(ctx, req)
+		stop()
+
+		// the result is stored before the lock is released, so a retry always
+		// finds one or the other
+		if o.storeCode(status.Code(err)) {
+			if data, merr := encode(resp, err, hash); merr == nil {
+				store.SetStringWithTTL(resultKey, string(data), seconds(o.ttl))
+			}
+		}
+		store.DelIfEqual(lockKey, token)
+		return resp, err
+	}
+}
+
+// lockToken returns a token unique to the call holding a lock, prefixed with
+// the hash of its request.
+func lockToken(hash string) string {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	return hash + "/" + hex.EncodeToString(nonce)
+}
+
+// lockHash returns the request hash of a lock token.
+func lockHash(token string) string {
+	if i := strings.LastIndexByte(token, '/'); i >= 0 {
+		return token[:i]
+	}
+	return token
+}
+
+// keepLock refreshes the lock every third of its TTL until stop is called, so
+// a call running longer than the lock TTL keeps its key. The lock still
+// expires once the process holding it dies, and is no longer refreshed once
+// another call took it.
+func keepLock(store redis.Locker, lockKey, token string, ttl time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(time.Duration(seconds(ttl)) * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if held, err := store.ExpireIfEqual(lockKey, token, seconds(ttl)); err == nil && !held {
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// requestHash returns the SHA-256 of the deterministic encoding of req, empty
+// when req is not a proto message.
+func requestHash(req interface{}) string {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return ""
+	}
+	b := proto.NewBuffer(nil)
+	b.SetDeterministic(true)
+	if err := b.Marshal(msg); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+func errRequestMismatch(key string) error {
+	return status.Errorf(codes.InvalidArgument, "idempotency: key %s was used with a different request", key)
+}
+
+// replayed is the response and error of a replayed call.
+type replayed struct {
+	resp        interface{}
+	err         error
+	requestHash string
+}
+
+// forRequest returns the replayed result, or codes.InvalidArgument when it was
+// stored for a request other than the one hashed to hash.
+func (r replayed) forRequest(key, hash string) (interface{}, error) {
+	if r.requestHash != "" && r.requestHash != hash {
+		return nil, errRequestMismatch(key)
+	}
+	return r.resp, r.err
+}
+
+// replay returns the stored result of resultKey, if any.
+func replay(store Store, resultKey string) (replayed, bool) {
+	data, err := store.GetString(resultKey)
+	if err != nil || data == "" {
+		return replayed{}, false
+	}
+
+	r, err := decode([]byte(data))
+	if err != nil {
+		return replayed{}, false
+	}
+	return r, true
+}
+
+func encode(resp interface{}, err error, hash string) ([]byte, error) {
+	r := result{RequestHash: hash}
+
+	st := status.New(codes.OK, "")
+	if err != nil {
+		st = status.Convert(err)
+	}
+	statusData, merr := proto.Marshal(st.Proto())
+	if merr != nil {
+		return nil, merr
+	}
+	r.Status = statusData
+
+	if err == nil {
+		msg, ok := resp.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("idempotency: response %T is not a proto message", resp)
+		}
+		if r.Response, merr = proto.Marshal(msg); merr != nil {
+			return nil, merr
+		}
+		r.ResponseType = proto.MessageName(msg)
+	}
+
+	return json.Marshal(r)
+}
+
+func decode(data []byte) (replayed, error) {
+	var r result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return replayed{}, err
+	}
+
+	st := &spb.Status{}
+	if err := proto.Unmarshal(r.Status, st); err != nil {
+		return replayed{}, err
+	}
+	if st.Code != int32(codes.OK) {
+		return replayed{err: status.ErrorProto(st), requestHash: r.RequestHash}, nil
+	}
+
+	t := proto.MessageType(r.ResponseType)
+	if t == nil {
+		return replayed{}, fmt.Errorf("idempotency: unknown response type %s", r.ResponseType)
+	}
+	msg := reflect.New(t.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(r.Response, msg); err != nil {
+		return replayed{}, err
+	}
+	return replayed{resp: msg, requestHash: r.RequestHash}, nil
+}
+
+// seconds rounds d up to whole seconds, at least one.
+func seconds(d time.Duration) int {
+	s := int((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
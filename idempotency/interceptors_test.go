@@ -0,0 +1,241 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// memoryStore implements Store in memory.
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string]string
+	sets map[string]int
+
+	// onDel is called with the keys present when a lock is released
+	onDel func(data map[string]string)
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{data: make(map[string]string), sets: make(map[string]int)}
+}
+
+func (s *memoryStore) setCount(k string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sets[k]
+}
+
+func (s *memoryStore) GetString(k string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[k], nil
+}
+
+func (s *memoryStore) SetStringWithTTL(k string, v string, ttl int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[k] = v
+	s.sets[k]++
+	return nil
+}
+
+func (s *memoryStore) SetStringNX(k string, v string, ttl int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[k]; ok {
+		return false, nil
+	}
+	s.data[k] = v
+	return true, nil
+}
+
+func (s *memoryStore) ExpireIfEqual(k string, v string, ttl int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data[k] != v {
+		return false, nil
+	}
+	s.sets[k]++
+	return true, nil
+}
+
+func (s *memoryStore) DelIfEqual(k string, v string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.onDel != nil {
+		s.onDel(s.data)
+	}
+	if s.data[k] != v {
+		return false, nil
+	}
+	delete(s.data, k)
+	return true, nil
+}
+
+func (s *memoryStore) set(k, v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[k] = v
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"}
+	withKey := func(key string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultMetadataKey, key))
+	}
+
+	t.Run("Replay response", func(t *testing.T) {
+		interceptor := UnaryServerInterceptor(newMemoryStore())
+		calls := 0
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls++
+			return &pb_testproto.PingResponse{Value: "pong", Counter: int32(calls)}, nil
+		}
+
+		for i := 0; i < 2; i++ {
+			resp, err := interceptor(withKey("k1"), &pb_testproto.PingRequest{}, info, handler)
+			require.NoError(t, err)
+			require.Equal(t, int32(1), resp.(*pb_testproto.PingResponse).Counter)
+		}
+		require.Equal(t, 1, calls)
+
+		_, err := interceptor(context.Background(), &pb_testproto.PingRequest{}, info, handler)
+		require.NoError(t, err)
+		require.Equal(t, 2, calls, "calls without key are not deduplicated")
+	})
+
+	t.Run("Replay error", func(t *testing.T) {
+		interceptor := UnaryServerInterceptor(newMemoryStore())
+		calls := 0
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls++
+			if calls == 1 {
+				return nil, status.Error(codes.Unavailable, "try again")
+			}
+			return nil, status.Error(codes.InvalidArgument, "bad amount")
+		}
+
+		_, err := interceptor(withKey("k2"), &pb_testproto.PingRequest{}, info, handler)
+		require.Equal(t, codes.Unavailable, status.Code(err))
+
+		for i := 0; i < 2; i++ {
+			_, err = interceptor(withKey("k2"), &pb_testproto.PingRequest{}, info, handler)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+			require.Equal(t, "bad amount", status.Convert(err).Message())
+		}
+		require.Equal(t, 2, calls, "transient errors are not stored")
+	})
+
+	t.Run("In flight", func(t *testing.T) {
+		interceptor := UnaryServerInterceptor(newMemoryStore())
+		started, release := make(chan struct{}), make(chan struct{})
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			return &pb_testproto.PingResponse{Value: "pong"}, nil
+		}
+
+		done := make(chan error)
+		go func() {
+			_, err := interceptor(withKey("k3"), &pb_testproto.PingRequest{}, info, handler)
+			done <- err
+		}()
+		<-started
+
+		_, err := interceptor(withKey("k3"), &pb_testproto.PingRequest{}, info, handler)
+		require.Equal(t, codes.Aborted, status.Code(err))
+
+		close(release)
+		require.NoError(t, <-done)
+	})
+
+	t.Run("Different request", func(t *testing.T) {
+		interceptor := UnaryServerInterceptor(newMemoryStore())
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &pb_testproto.PingResponse{Value: req.(*pb_testproto.PingRequest).Value}, nil
+		}
+
+		resp, err := interceptor(withKey("k4"), &pb_testproto.PingRequest{Value: "a"}, info, handler)
+		require.NoError(t, err)
+		require.Equal(t, "a", resp.(*pb_testproto.PingResponse).Value)
+
+		_, err = interceptor(withKey("k4"), &pb_testproto.PingRequest{Value: "b"}, info, handler)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Lock refresh", func(t *testing.T) {
+		store := newMemoryStore()
+		interceptor := UnaryServerInterceptor(store, WithLockTTL(time.Second))
+		lockKey := DefaultKeyPrefix + info.FullMethod + ":k5:lock"
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			// longer than a third of the lock TTL
+			time.Sleep(500 * time.Millisecond)
+			return &pb_testproto.PingResponse{}, nil
+		}
+
+		_, err := interceptor(withKey("k5"), &pb_testproto.PingRequest{}, info, handler)
+		require.NoError(t, err)
+		require.NotZero(t, store.setCount(lockKey), "the lock is refreshed while the call runs")
+		v, _ := store.GetString(lockKey)
+		require.Empty(t, v, "the lock is released")
+	})
+
+	t.Run("Lock taken over", func(t *testing.T) {
+		store := newMemoryStore()
+		interceptor := UnaryServerInterceptor(store, WithLockTTL(time.Second))
+		lockKey := DefaultKeyPrefix + info.FullMethod + ":k6:lock"
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			// the lock expired and another call took it
+			store.set(lockKey, "other")
+			time.Sleep(500 * time.Millisecond)
+			return &pb_testproto.PingResponse{}, nil
+		}
+
+		_, err := interceptor(withKey("k6"), &pb_testproto.PingRequest{}, info, handler)
+		require.NoError(t, err)
+		require.Zero(t, store.setCount(lockKey), "another call's lock is not refreshed")
+		v, _ := store.GetString(lockKey)
+		require.Equal(t, "other", v, "another call's lock is not released")
+	})
+
+	t.Run("Result before unlock", func(t *testing.T) {
+		store := newMemoryStore()
+		resultKey := DefaultKeyPrefix + info.FullMethod + ":k7"
+		var stored bool
+		store.onDel = func(data map[string]string) {
+			_, stored = data[resultKey]
+		}
+		interceptor := UnaryServerInterceptor(store)
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &pb_testproto.PingResponse{}, nil
+		}
+
+		_, err := interceptor(withKey("k7"), &pb_testproto.PingRequest{}, info, handler)
+		require.NoError(t, err)
+		require.True(t, stored, "the result is stored before the lock is released")
+	})
+
+	t.Run("Request field", func(t *testing.T) {
+		interceptor := UnaryServerInterceptor(newMemoryStore(), WithKeyFunc(RequestField("value")))
+		calls := 0
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls++
+			return &pb_testproto.PingResponse{}, nil
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err := interceptor(context.Background(), &pb_testproto.PingRequest{Value: "trans-1"}, info, handler)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,165 @@
+package idempotency
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// DefaultMetadataKey carries the idempotency key. The gateway forwards the
+	// Idempotency-Key HTTP header to it.
+	DefaultMetadataKey = "idempotency-key"
+
+	// DefaultTTL is how long a result is replayed.
+	DefaultTTL = 24 * time.Hour
+
+	// DefaultLockTTL bounds how long the key of a call stays locked once the
+	// process running it dies. The lock is refreshed while the call runs.
+	DefaultLockTTL = time.Minute
+
+	// DefaultKeyPrefix prefixes the redis keys.
+	DefaultKeyPrefix = "idempotency:"
+)
+
+var (
+	defaultOptions = &options{
+		keyFunc:   MetadataKey(DefaultMetadataKey),
+		ttl:       DefaultTTL,
+		lockTTL:   DefaultLockTTL,
+		keyPrefix: DefaultKeyPrefix,
+		storeCode: DefaultStoreCode,
+	}
+)
+
+type options struct {
+	keyFunc   KeyFunc
+	ttl       time.Duration
+	lockTTL   time.Duration
+	keyPrefix string
+	storeCode func(code codes.Code) bool
+}
+
+func evaluateOpt(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// Option ...
+type Option func(*options)
+
+// KeyFunc returns the idempotency key of a call, empty when the call has none.
+type KeyFunc func(ctx context.Context, fullMethod string, req interface{}) string
+
+// WithKeyFunc customizes how the idempotency key is found.
+func WithKeyFunc(f KeyFunc) Option {
+	return func(o *options) {
+		o.keyFunc = f
+	}
+}
+
+// WithTTL sets how long a result is replayed.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithLockTTL sets how long the key of a call stays locked once the process
+// running it dies, before a duplicate may run.
+func WithLockTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.lockTTL = ttl
+	}
+}
+
+// WithKeyPrefix sets the prefix of the redis keys.
+func WithKeyPrefix(prefix string) Option {
+	return func(o *options) {
+		o.keyPrefix = prefix
+	}
+}
+
+// WithStoreCode decides which results are stored and replayed.
+func WithStoreCode(f func(code codes.Code) bool) Option {
+	return func(o *options) {
+		o.storeCode = f
+	}
+}
+
+// DefaultStoreCode stores the successes and the errors a retry would not
+// fix. Transient errors are not stored so the client can retry.
+func DefaultStoreCode(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Canceled, codes.DeadlineExceeded, codes.Aborted,
+		codes.ResourceExhausted, codes.Unavailable, codes.Internal:
+		return false
+	}
+	return true
+}
+
+// MetadataKey reads the idempotency key from the incoming metadata key.
+func MetadataKey(key string) KeyFunc {
+	return func(ctx context.Context, fullMethod string, req interface{}) string {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+}
+
+// RequestField reads the idempotency key from a string field of the request
+// message, named by its Go name or its proto name, e.g. "app_trans_id".
+func RequestField(name string) KeyFunc {
+	return func(ctx context.Context, fullMethod string, req interface{}) string {
+		v := reflect.ValueOf(req)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return ""
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if sf.Name != name && protoName(sf) != name {
+				continue
+			}
+			if f := v.Field(i); f.Kind() == reflect.String {
+				return f.String()
+			}
+		}
+		return ""
+	}
+}
+
+// FirstKey returns the first non empty key of funcs, e.g. the metadata key
+// then a request field.
+func FirstKey(funcs ...KeyFunc) KeyFunc {
+	return func(ctx context.Context, fullMethod string, req interface{}) string {
+		for _, f := range funcs {
+			if key := f(ctx, fullMethod, req); key != "" {
+				return key
+			}
+		}
+		return ""
+	}
+}
+
+func protoName(sf reflect.StructField) string {
+	for _, part := range strings.Split(sf.Tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(part, "name=") {
+			return strings.TrimPrefix(part, "name=")
+		}
+	}
+	return ""
+}
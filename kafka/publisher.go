@@ -12,6 +12,7 @@ import (
 // Publisher ...
 type Publisher struct {
 	config   PublisherConfig
+	client   sarama.Client
 	producer sarama.SyncProducer
 	logger   log.Factory
 
@@ -29,13 +30,20 @@ func NewPublisher(
 		return nil, err
 	}
 
-	producer, err := sarama.NewSyncProducer(config.Brokers, config.OverwriteSaramaConfig)
+	client, err := sarama.NewClient(config.Brokers, config.OverwriteSaramaConfig)
 	if err != nil {
+		return nil, errors.Wrap(err, "cannot create Kafka client")
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
 		return nil, errors.Wrap(err, "cannot create Kafka producer")
 	}
 
 	return &Publisher{
 		config:   config,
+		client:   client,
 		producer: producer,
 		logger:   logger,
 	}, nil
@@ -127,6 +135,22 @@ func (p *Publisher) Close() error {
 	if err := p.producer.Close(); err != nil {
 		return errors.Wrap(err, "cannot close Kafka producer")
 	}
+	if err := p.client.Close(); err != nil {
+		return errors.Wrap(err, "cannot close Kafka client")
+	}
+
+	return nil
+}
+
+// Ping checks that the publisher is open and at least one broker is reachable.
+func (p *Publisher) Ping() error {
+	if p.closed {
+		return errors.New("publisher closed")
+	}
+
+	if _, err := p.client.RefreshController(); err != nil {
+		return errors.Wrap(err, "cannot reach Kafka controller")
+	}
 
 	return nil
 }
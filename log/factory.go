@@ -131,7 +131,12 @@ func (b Factory) For(ctx context.Context) Logger {
 
 // With creates a child logger, and optionally adds some context fields to that logger.
 func (b Factory) With(fields ...zapcore.Field) Factory {
-	return Factory{logger: b.logger.With(fields...)}
+	return Factory{logger: b.logger.With(fields...), level: b.level}
+}
+
+// IsLevelAdjustable returns true if the level can be changed at runtime with EnableLevel.
+func (b Factory) IsLevelAdjustable() bool {
+	return b.level != nil
 }
 
 // EnableLevel ...
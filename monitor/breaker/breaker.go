@@ -0,0 +1,154 @@
+// Package breaker runs the client calls through hystrix circuit breakers, one
+// per method, configured per service and per method, with fallbacks.
+//
+// The config of a method is, from the highest precedence, the runtime config
+// of the method set by hystrixconfig.SetCommandConfigs (see dynconfig), the
+// config of the method, the config of its service, then the runtime default
+// config. hystrix commands are global: clients sharing a method share its
+// breaker, and clients configuring it differently apply their config in turn
+// before their calls.
+package breaker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/richard-xtek/go-grpc-micro-kit/monitor/hystrixconfig"
+)
+
+// Fallback handles a call failed by the breaker: the circuit is open, the
+// call timed out or failed with a server error. It may fill reply, e.g. with
+// a cached or default value, and return nil, or return an error.
+type Fallback func(ctx context.Context, method string, req, reply interface{}, err error) error
+
+// NewBreaker returns a breaker with the runtime configs of hystrixconfig.
+func NewBreaker() *Breaker {
+	return &Breaker{
+		enabled:   func() bool { return true },
+		services:  make(map[string]hystrix.CommandConfig),
+		methods:   make(map[string]hystrix.CommandConfig),
+		fallbacks: make(map[string]Fallback),
+	}
+}
+
+// Breaker holds the circuit breaker settings of a client. Services are named
+// like payment.Payment and methods by their full name, e.g.
+// /payment.Payment/Pay.
+type Breaker struct {
+	enabled   func() bool
+	services  map[string]hystrix.CommandConfig
+	methods   map[string]hystrix.CommandConfig
+	fallbacks map[string]Fallback
+	timeout   func(method string) time.Duration
+}
+
+// applied are the configs applied to the hystrix commands, shared by the
+// breakers as the commands are.
+var applied = struct {
+	sync.Mutex
+	configs map[string]hystrix.CommandConfig
+}{configs: make(map[string]hystrix.CommandConfig)}
+
+// WithEnabled runs the calls through the breaker only while enabled returns
+// true. By default the breaker is always on.
+func (b *Breaker) WithEnabled(enabled func() bool) *Breaker {
+	b.enabled = enabled
+	return b
+}
+
+// WithServiceConfig configures the breakers of the methods of service.
+func (b *Breaker) WithServiceConfig(service string, config hystrix.CommandConfig) *Breaker {
+	b.services[strings.Trim(service, "/")] = config
+	return b
+}
+
+// WithMethodConfig configures the breaker of method.
+func (b *Breaker) WithMethodConfig(method string, config hystrix.CommandConfig) *Breaker {
+	b.methods[method] = config
+	return b
+}
+
+// WithFallback handles the failed calls of method, or of all the methods of
+// a service named like payment.Payment. Fallbacks apply to unary calls.
+func (b *Breaker) WithFallback(method string, fallback Fallback) *Breaker {
+	b.fallbacks[method] = fallback
+	return b
+}
+
+// BoundedBy returns a breaker with the settings of b whose hystrix timeout of
+// a method is at least timeout(method), e.g. the deadline of the calls set by
+// the client, which then bounds them. b is unchanged.
+func (b *Breaker) BoundedBy(timeout func(method string) time.Duration) *Breaker {
+	return &Breaker{
+		enabled:   b.enabled,
+		services:  b.services,
+		methods:   b.methods,
+		fallbacks: b.fallbacks,
+		timeout:   timeout,
+	}
+}
+
+// config returns the config of method.
+func (b *Breaker) config(method string) hystrix.CommandConfig {
+	config := b.lookupConfig(method)
+	if b.timeout == nil {
+		return config
+	}
+
+	current := config.Timeout
+	if current == 0 {
+		current = hystrix.DefaultTimeout
+	}
+	if timeout := int(b.timeout(method) / time.Millisecond); timeout > current {
+		config.Timeout = timeout
+	}
+	return config
+}
+
+func (b *Breaker) lookupConfig(method string) hystrix.CommandConfig {
+	if config, ok := hystrixconfig.LookupCommandConfig(method); ok {
+		return config
+	}
+	if config, ok := b.methods[method]; ok {
+		return config
+	}
+	if config, ok := b.services[service(method)]; ok {
+		return config
+	}
+	return hystrixconfig.HystrixConfig()
+}
+
+func (b *Breaker) fallback(method string) Fallback {
+	if fallback, ok := b.fallbacks[method]; ok {
+		return fallback
+	}
+	return b.fallbacks[service(method)]
+}
+
+// configure applies the config of method to its hystrix command when it
+// changed.
+func (b *Breaker) configure(method string) {
+	config := b.config(method)
+
+	applied.Lock()
+	defer applied.Unlock()
+
+	if current, ok := applied.configs[method]; ok && current == config {
+		return
+	}
+	hystrix.ConfigureCommand(method, config)
+	applied.configs[method] = config
+	commands.add(method)
+}
+
+// service returns the service of a full method name, e.g. payment.Payment.
+func service(method string) string {
+	method = strings.TrimPrefix(method, "/")
+	if i := strings.LastIndex(method, "/"); i >= 0 {
+		return method[:i]
+	}
+	return method
+}
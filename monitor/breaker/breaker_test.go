@@ -0,0 +1,190 @@
+package breaker
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	// the circuits are global
+	defer hystrix.Flush()
+
+	tripping := hystrix.CommandConfig{Timeout: 1000, RequestVolumeThreshold: 2, ErrorPercentThreshold: 50, SleepWindow: 60000}
+	failing := func(code codes.Code) (grpc.UnaryInvoker, *int) {
+		calls := 0
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			return status.Error(code, "failed")
+		}, &calls
+	}
+
+	t.Run("Open circuit and fallback", func(t *testing.T) {
+		method := "/breaker.Test/Open"
+		b := NewBreaker().
+			WithServiceConfig("breaker.Test", tripping).
+			WithFallback(method, func(ctx context.Context, method string, req, reply interface{}, err error) error {
+				reply.(*pb_testproto.PingResponse).Value = "cached"
+				return nil
+			})
+		interceptor := UnaryClientInterceptor(b)
+		invoker, calls := failing(codes.Unavailable)
+
+		for i := 0; i < 3; i++ {
+			interceptor(context.Background(), method, nil, &pb_testproto.PingResponse{}, nil, invoker)
+		}
+		require.Eventually(t, func() bool {
+			circuit, _, _ := hystrix.GetCircuit(method)
+			return circuit.IsOpen()
+		}, time.Second, 10*time.Millisecond)
+		commands.mu.Lock()
+		require.True(t, commands.names[method], "the command is exported")
+		commands.mu.Unlock()
+		require.Equal(t, float64(1), testutil.ToFloat64(&commandCollector{names: map[string]bool{method: true}}))
+
+		before := *calls
+		reply := &pb_testproto.PingResponse{}
+		require.NoError(t, interceptor(context.Background(), method, nil, reply, nil, invoker))
+		require.Equal(t, "cached", reply.Value)
+		require.Equal(t, before, *calls, "the open circuit does not call the server")
+
+		b.WithFallback(method, nil)
+		err := interceptor(context.Background(), method, nil, &pb_testproto.PingResponse{}, nil, invoker)
+		require.Equal(t, codes.Unavailable, status.Code(err))
+	})
+
+	t.Run("Client errors", func(t *testing.T) {
+		method := "/breaker.Test/Invalid"
+		interceptor := UnaryClientInterceptor(NewBreaker().WithMethodConfig(method, tripping))
+		invoker, calls := failing(codes.InvalidArgument)
+
+		for i := 0; i < 5; i++ {
+			err := interceptor(context.Background(), method, nil, &pb_testproto.PingResponse{}, nil, invoker)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+		}
+		require.Equal(t, 5, *calls, "client errors do not trip the circuit")
+	})
+
+	t.Run("Reply", func(t *testing.T) {
+		interceptor := UnaryClientInterceptor(NewBreaker())
+		reply := &pb_testproto.PingResponse{}
+		err := interceptor(context.Background(), "/breaker.Test/Reply", nil, reply, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				reply.(*pb_testproto.PingResponse).Value = "pong"
+				return nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, "pong", reply.Value)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		method := "/breaker.Test/Canceled"
+		fallbacks := 0
+		interceptor := UnaryClientInterceptor(NewBreaker().
+			WithMethodConfig(method, tripping).
+			WithFallback(method, func(ctx context.Context, method string, req, reply interface{}, err error) error {
+				fallbacks++
+				return nil
+			}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err := interceptor(ctx, method, nil, &pb_testproto.PingResponse{}, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				cancel()
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				return status.FromContextError(ctx.Err()).Err()
+			})
+		require.Equal(t, codes.Canceled, status.Code(err))
+		require.Zero(t, fallbacks, "canceled calls do not fall back")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		interceptor := UnaryClientInterceptor(NewBreaker().WithEnabled(func() bool { return false }))
+		invoker, _ := failing(codes.Unavailable)
+		interceptor(context.Background(), "/breaker.Test/Disabled", nil, nil, nil, invoker)
+
+		_, ok := hystrix.GetCircuitSettings()["/breaker.Test/Disabled"]
+		require.False(t, ok)
+	})
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	defer hystrix.Flush()
+
+	t.Run("Late stream", func(t *testing.T) {
+		method := "/breaker.Test/LateStream"
+		interceptor := StreamClientInterceptor(NewBreaker().WithMethodConfig(method, hystrix.CommandConfig{Timeout: 10}))
+
+		opened := make(chan context.Context, 1)
+		_, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, method,
+			func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				time.Sleep(50 * time.Millisecond)
+				opened <- ctx
+				return nil, nil
+			})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+		select {
+		case ctx := <-opened:
+			<-ctx.Done()
+		case <-time.After(time.Second):
+			t.Fatal("stream not opened")
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		interceptor := StreamClientInterceptor(NewBreaker())
+
+		var streamCtx context.Context
+		stream, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/breaker.Test/Stream",
+			func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				streamCtx = ctx
+				return &doneStream{}, nil
+			})
+		require.NoError(t, err)
+		require.NoError(t, streamCtx.Err(), "the stream outlives the interceptor")
+
+		require.Equal(t, io.EOF, stream.RecvMsg(nil))
+		require.Error(t, streamCtx.Err(), "released once done")
+	})
+}
+
+// doneStream is a stream with no message.
+type doneStream struct {
+	grpc.ClientStream
+}
+
+func (s *doneStream) RecvMsg(m interface{}) error {
+	return io.EOF
+}
+
+func TestBreaker_BoundedBy(t *testing.T) {
+	method := "/breaker.Test/Bounded"
+	b := NewBreaker().WithMethodConfig(method, hystrix.CommandConfig{Timeout: 100})
+	bounded := b.BoundedBy(func(string) time.Duration { return time.Second })
+
+	require.Equal(t, 1000, bounded.config(method).Timeout)
+	require.Equal(t, 100, b.config(method).Timeout, "b is unchanged")
+	require.Equal(t, 100, b.BoundedBy(func(string) time.Duration { return 0 }).config(method).Timeout)
+}
+
+func TestBreaker_configure(t *testing.T) {
+	method := "/breaker.Test/Shared"
+	b := NewBreaker().WithMethodConfig(method, hystrix.CommandConfig{Timeout: 100})
+	bounded := b.BoundedBy(func(string) time.Duration { return time.Second })
+
+	b.configure(method)
+	bounded.configure(method)
+	b.configure(method)
+	require.Equal(t, 100*time.Millisecond, hystrix.GetCircuitSettings()[method].Timeout, "the last config applied is the one of the caller")
+}
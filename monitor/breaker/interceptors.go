@@ -0,0 +1,180 @@
+package breaker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor runs the unary calls through the breaker of their
+// method and through its fallback when they fail.
+func UnaryClientInterceptor(b *Breaker) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !b.enabled() {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		b.configure(method)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// a call outliving the hystrix timeout must not write reply once the
+		// interceptor returned
+		var (
+			mu       sync.Mutex
+			returned bool
+			callErr  error
+		)
+		err := hystrix.DoC(runCtx, method, func(ctx context.Context) error {
+			err := invokeInto(ctx, method, req, reply, cc, invoker, func(commit func()) {
+				mu.Lock()
+				defer mu.Unlock()
+				if !returned {
+					commit()
+				}
+			}, opts...)
+			if err != nil && !isFailure(status.Code(err)) {
+				// client errors do not trip the circuit
+				mu.Lock()
+				callErr = err
+				mu.Unlock()
+				return nil
+			}
+			return err
+		}, nil)
+
+		mu.Lock()
+		returned = true
+		if err == nil {
+			err = callErr
+		}
+		mu.Unlock()
+
+		if err == nil {
+			return nil
+		}
+		err = toStatus(err)
+		if fallback := b.fallback(method); fallback != nil && isFailure(status.Code(err)) {
+			return fallback(ctx, method, req, reply, err)
+		}
+		return err
+	}
+}
+
+// StreamClientInterceptor opens the streams through the breaker of their
+// method. The hystrix timeout bounds the opening of a stream, not its life.
+func StreamClientInterceptor(b *Breaker) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !b.enabled() {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		b.configure(method)
+
+		// cancels a stream opened after the timeout, or failing
+		streamCtx, cancel := context.WithCancel(ctx)
+
+		var (
+			mu       sync.Mutex
+			returned bool
+			stream   grpc.ClientStream
+			callErr  error
+		)
+		err := hystrix.DoC(ctx, method, func(hctx context.Context) error {
+			s, err := streamer(streamCtx, desc, cc, method, opts...)
+			if err != nil && !isFailure(status.Code(err)) {
+				mu.Lock()
+				callErr = err
+				mu.Unlock()
+				return nil
+			}
+			if err == nil {
+				mu.Lock()
+				if returned {
+					// opened after the timeout, nobody will read it
+					cancel()
+				} else {
+					stream = s
+				}
+				mu.Unlock()
+			}
+			return err
+		}, nil)
+
+		mu.Lock()
+		defer mu.Unlock()
+		returned = true
+		if err != nil {
+			cancel()
+			return nil, toStatus(err)
+		}
+		if callErr != nil {
+			cancel()
+			return nil, callErr
+		}
+		return &cancelStream{ClientStream: stream, cancel: cancel}, nil
+	}
+}
+
+// cancelStream releases the context of a stream once it is done.
+type cancelStream struct {
+	grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+func (s *cancelStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.cancel()
+	}
+	return err
+}
+
+// invokeInto invokes the call into a copy of reply when it is a proto
+// message, and copies it to reply through commit.
+func invokeInto(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, commit func(func()), opts ...grpc.CallOption) error {
+	msg, ok := reply.(proto.Message)
+	if !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	tmp := proto.Clone(msg)
+	tmp.Reset()
+	if err := invoker(ctx, method, req, tmp, cc, opts...); err != nil {
+		return err
+	}
+	commit(func() {
+		msg.Reset()
+		proto.Merge(msg, tmp)
+	})
+	return nil
+}
+
+// isFailure reports whether code is a failure of the server, counted by the
+// breaker.
+func isFailure(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown,
+		codes.ResourceExhausted, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// toStatus maps the hystrix and context errors to gRPC statuses.
+func toStatus(err error) error {
+	switch err {
+	case hystrix.ErrCircuitOpen, hystrix.ErrMaxConcurrency:
+		return status.Error(codes.Unavailable, err.Error())
+	case hystrix.ErrTimeout, context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case context.Canceled:
+		// the caller gave up, not a failure of the server
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package breaker
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var openDesc = prometheus.NewDesc(
+	"grpc_client_circuit_breaker_open",
+	"Whether the circuit breaker of a client method is open (1) or closed (0).",
+	[]string{"grpc_service", "grpc_method"}, nil,
+)
+
+// commands are the hystrix commands configured by a breaker.
+var commands = &commandCollector{names: make(map[string]bool)}
+
+func init() {
+	prometheus.MustRegister(commands)
+}
+
+// commandCollector exports the state of the circuit of each command.
+type commandCollector struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func (c *commandCollector) add(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.names[name] = true
+}
+
+// Describe implements prometheus.Collector
+func (c *commandCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *commandCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.names))
+	for name := range c.names {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	for _, name := range names {
+		circuit, _, err := hystrix.GetCircuit(name)
+		if err != nil {
+			continue
+		}
+		var open float64
+		if circuit.IsOpen() {
+			open = 1
+		}
+		method := name[strings.LastIndex(name, "/")+1:]
+		ch <- prometheus.MustNewConstMetric(openDesc, prometheus.GaugeValue, open, service(name), method)
+	}
+}
@@ -3,6 +3,7 @@ package hystrixconfig
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/afex/hystrix-go/hystrix"
 )
@@ -10,6 +11,21 @@ import (
 var hystrixStream *hystrix.StreamHandler
 var once sync.Once
 
+var (
+	mu             sync.RWMutex
+	defaultConfig  *hystrix.CommandConfig
+	commandConfigs = make(map[string]hystrix.CommandConfig)
+
+	// enabled is the runtime toggle, enabledUnset until SetEnabled
+	enabled int32
+)
+
+const (
+	enabledUnset int32 = iota
+	enabledOff
+	enabledOn
+)
+
 // StreamHandler ...
 func StreamHandler() *hystrix.StreamHandler {
 	once.Do(func() {
@@ -20,8 +36,92 @@ func StreamHandler() *hystrix.StreamHandler {
 	return hystrixStream
 }
 
-// HystrixConfig ...
+// HystrixConfig returns the default command config.
 func HystrixConfig() hystrix.CommandConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if defaultConfig != nil {
+		return *defaultConfig
+	}
+	return builtinConfig()
+}
+
+// SetDefaultConfig replaces the default command config at runtime.
+func SetDefaultConfig(config hystrix.CommandConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaultConfig = &config
+}
+
+// CommandConfig returns the config of the named command, the default
+// config when the command has none.
+func CommandConfig(name string) hystrix.CommandConfig {
+	mu.RLock()
+	config, ok := commandConfigs[name]
+	mu.RUnlock()
+
+	if ok {
+		return config
+	}
+	return HystrixConfig()
+}
+
+// LookupCommandConfig returns the config set for the named command with
+// SetCommandConfigs, if any.
+func LookupCommandConfig(name string) (hystrix.CommandConfig, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	config, ok := commandConfigs[name]
+	return config, ok
+}
+
+// SetCommandConfigs replaces the per command configs at runtime.
+func SetCommandConfigs(configs map[string]hystrix.CommandConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	commandConfigs = make(map[string]hystrix.CommandConfig, len(configs))
+	for name, config := range configs {
+		commandConfigs[name] = config
+	}
+}
+
+// Enabled reports whether hystrix was enabled at runtime with SetEnabled.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == enabledOn
+}
+
+// EnabledOr reports whether hystrix is enabled at runtime, or returns
+// fallback, e.g. a process flag, while the runtime toggle is unset.
+func EnabledOr(fallback bool) bool {
+	switch atomic.LoadInt32(&enabled) {
+	case enabledOn:
+		return true
+	case enabledOff:
+		return false
+	}
+	return fallback
+}
+
+// SetEnabled enables or disables hystrix in the client interceptors at
+// runtime, overriding the process flags.
+func SetEnabled(isEnabled bool) {
+	v := enabledOff
+	if isEnabled {
+		v = enabledOn
+	}
+	atomic.StoreInt32(&enabled, v)
+}
+
+// ResetEnabled unsets the runtime toggle so the process flags apply again.
+func ResetEnabled() {
+	atomic.StoreInt32(&enabled, enabledUnset)
+}
+
+func builtinConfig() hystrix.CommandConfig {
 	return hystrix.CommandConfig{
 		// How long to wait for command to complete, in milliseconds
 		Timeout: 3000,
@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Defaults of the concurrency limiter.
+const (
+	DefaultInitialConcurrency = 20
+	DefaultMinConcurrency     = 1
+	DefaultMaxConcurrency     = 1000
+	DefaultTargetLatency      = 500 * time.Millisecond
+	DefaultBackoffRatio       = 0.9
+	DefaultStreamConcurrency  = 1000
+)
+
+// NewConcurrencyLimiter returns an adaptive limit of the calls in flight per
+// method. The limit of a method grows by one per limit calls finishing within
+// the target latency and shrinks by the backoff ratio when a call is slower
+// or fails with an overload code, so it follows what the method can serve.
+//
+// Streams have a static limit per method instead: how long a stream stays
+// open, e.g. a subscription, says nothing about the load of the server.
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		initial:       DefaultInitialConcurrency,
+		min:           DefaultMinConcurrency,
+		max:           DefaultMaxConcurrency,
+		targetLatency: DefaultTargetLatency,
+		backoffRatio:  DefaultBackoffRatio,
+		streamLimit:   DefaultStreamConcurrency,
+		methods:       make(map[string]*methodConcurrency),
+		now:           time.Now,
+	}
+}
+
+// ConcurrencyLimiter limits the calls in flight per method.
+type ConcurrencyLimiter struct {
+	initial       float64
+	min           float64
+	max           float64
+	targetLatency time.Duration
+	backoffRatio  float64
+	streamLimit   int
+
+	mu      sync.Mutex
+	methods map[string]*methodConcurrency
+	now     func() time.Time
+}
+
+type methodConcurrency struct {
+	limit    float64
+	inflight int
+	streams  int
+}
+
+// WithLimits sets the initial, the min and the max concurrency of a method.
+func (c *ConcurrencyLimiter) WithLimits(initial, min, max int) *ConcurrencyLimiter {
+	c.initial, c.min, c.max = float64(initial), float64(min), float64(max)
+	return c
+}
+
+// WithTargetLatency sets the latency above which the limit shrinks.
+func (c *ConcurrencyLimiter) WithTargetLatency(latency time.Duration) *ConcurrencyLimiter {
+	c.targetLatency = latency
+	return c
+}
+
+// WithBackoffRatio sets how much the limit shrinks, between 0 and 1.
+func (c *ConcurrencyLimiter) WithBackoffRatio(ratio float64) *ConcurrencyLimiter {
+	c.backoffRatio = ratio
+	return c
+}
+
+// WithStreamLimit sets the static limit of the streams open per method.
+func (c *ConcurrencyLimiter) WithStreamLimit(limit int) *ConcurrencyLimiter {
+	c.streamLimit = limit
+	return c
+}
+
+func (c *ConcurrencyLimiter) method(fullMethod string) *methodConcurrency {
+	m, found := c.methods[fullMethod]
+	if !found {
+		m = &methodConcurrency{limit: c.initial}
+		c.methods[fullMethod] = m
+	}
+	return m
+}
+
+// Acquire takes a slot of fullMethod. When it succeeds, done must be called
+// with the code of the call once it finishes.
+func (c *ConcurrencyLimiter) Acquire(fullMethod string) (done func(code codes.Code), ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.method(fullMethod)
+	if m.inflight >= int(m.limit) {
+		return nil, false
+	}
+	m.inflight++
+
+	start := c.now()
+	return func(code codes.Code) {
+		c.release(m, c.now().Sub(start), code)
+	}, true
+}
+
+// AcquireStream takes a stream slot of fullMethod under the static stream
+// limit. When it succeeds, done must be called once the stream ends.
+func (c *ConcurrencyLimiter) AcquireStream(fullMethod string) (done func(), ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.method(fullMethod)
+	if m.streams >= c.streamLimit {
+		return nil, false
+	}
+	m.streams++
+
+	return func() {
+		c.mu.Lock()
+		m.streams--
+		c.mu.Unlock()
+	}, true
+}
+
+// Limit returns the current limit of fullMethod.
+func (c *ConcurrencyLimiter) Limit(fullMethod string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if m, ok := c.methods[fullMethod]; ok {
+		return int(m.limit)
+	}
+	return int(c.initial)
+}
+
+func (c *ConcurrencyLimiter) release(m *methodConcurrency, latency time.Duration, code codes.Code) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m.inflight--
+	switch {
+	case code == codes.ResourceExhausted || code == codes.DeadlineExceeded || latency > c.targetLatency:
+		m.limit = math.Max(c.min, m.limit*c.backoffRatio)
+	case code == codes.OK:
+		m.limit = math.Min(c.max, m.limit+1/m.limit)
+	}
+}
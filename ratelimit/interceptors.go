@@ -0,0 +1,131 @@
+// Package ratelimit protects a service from clients sending more than it can
+// serve. The rate limit interceptors give each method a token bucket, shared
+// by all the calls or per user, client IP or service provider, kept in memory
+// or in redis. The concurrency interceptors adapt the calls in flight per
+// method to its latency. Rejected calls get codes.ResourceExhausted with an
+// errdetails.RetryInfo.
+//
+// The interceptors go after the requestinfo slot of the server chain:
+//
+//	limits := ratelimit.NewLimits(map[string]ratelimit.Limit{
+//		ratelimit.DefaultLimit: {Rate: 100, Burst: 20},
+//		"/payment.Payment/Pay":  {Rate: 10, Burst: 5},
+//	})
+//	grpcServer.ReplaceUnaryServerInterceptor(server.InterceptorRateLimit,
+//		ratelimit.UnaryServerInterceptor(ratelimit.NewLocalLimiter(), limits, ratelimit.WithKeyFunc(ratelimit.ByUser)))
+//
+// The limits may follow dynconfig.Watcher.WithRateLimits.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var rejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_server_rate_limited_total",
+	Help: "Total number of gRPC calls rejected by a rate or concurrency limit.",
+}, []string{"grpc_service", "grpc_method", "limiter"})
+
+// Values of the limiter label of grpc_server_rate_limited_total.
+const (
+	limiterRate        = "rate"
+	limiterConcurrency = "concurrency"
+)
+
+// UnaryServerInterceptor rejects the calls over their method limit.
+func UnaryServerInterceptor(limiter Limiter, limits *Limits, opts ...Option) grpc.UnaryServerInterceptor {
+	o := evaluateOpt(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allow(ctx, limiter, limits, o, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects the streams over their method limit.
+func StreamServerInterceptor(limiter Limiter, limits *Limits, opts ...Option) grpc.StreamServerInterceptor {
+	o := evaluateOpt(opts)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(stream.Context(), limiter, limits, o, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// ConcurrencyUnaryServerInterceptor rejects the calls over the concurrency
+// limit of their method.
+func ConcurrencyUnaryServerInterceptor(limiter *ConcurrencyLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done, ok := limiter.Acquire(info.FullMethod)
+		if !ok {
+			return nil, rejected(info.FullMethod, limiterConcurrency, limiter.targetLatency)
+		}
+		resp, err := handler(ctx, req)
+		done(status.Code(err))
+		return resp, err
+	}
+}
+
+// ConcurrencyStreamServerInterceptor rejects the streams over the static
+// stream limit of their method. Streams do not adapt the limit of the unary
+// calls.
+func ConcurrencyStreamServerInterceptor(limiter *ConcurrencyLimiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done, ok := limiter.AcquireStream(info.FullMethod)
+		if !ok {
+			return rejected(info.FullMethod, limiterConcurrency, limiter.targetLatency)
+		}
+		defer done()
+		return handler(srv, stream)
+	}
+}
+
+func allow(ctx context.Context, limiter Limiter, limits *Limits, o *options, fullMethod string) error {
+	limit, ok := limits.For(fullMethod)
+	if !ok {
+		return nil
+	}
+
+	allowed, wait, err := limiter.Allow(fullMethod+":"+o.keyFunc(ctx, fullMethod), limit)
+	if err != nil {
+		if o.failOpen {
+			return nil
+		}
+		return status.Errorf(codes.Unavailable, "ratelimit: %v", err)
+	}
+	if !allowed {
+		return rejected(fullMethod, limiterRate, wait)
+	}
+	return nil
+}
+
+// rejected counts the rejection and returns its status.
+func rejected(fullMethod, limiter string, retryDelay time.Duration) error {
+	service, method := path.Dir(fullMethod), path.Base(fullMethod)
+	if len(service) > 0 && service[0] == '/' {
+		service = service[1:]
+	}
+	rejectedTotal.WithLabelValues(service, method, limiter).Inc()
+
+	msg := fmt.Sprintf("ratelimit: %s is over its %s limit", fullMethod, limiter)
+	st, err := status.New(codes.ResourceExhausted, msg).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: ptypes.DurationProto(retryDelay),
+	})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+	return st.Err()
+}
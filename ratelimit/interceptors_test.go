@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/richard-xtek/go-grpc-micro-kit/auth/requestinfo"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memoryStore implements redis.TokenTaker with the buckets of a local limiter.
+type memoryStore struct {
+	local *localLimiter
+	keys  []string
+}
+
+func (s *memoryStore) TakeToken(k string, rate float64, burst int) (bool, time.Duration, error) {
+	s.keys = append(s.keys, k)
+	return s.local.Allow(k, Limit{Rate: rate, Burst: burst})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "pong", nil
+	}
+	asUser := func(userID string) context.Context {
+		return requestinfo.NewContext(context.Background(), &requestinfo.RequestInfo{UserID: userID})
+	}
+	limits := NewLimits(map[string]Limit{info.FullMethod: {Rate: 1, Burst: 2}})
+
+	t.Run("Local", func(t *testing.T) {
+		now := time.Now()
+		limiter := NewLocalLimiter().(*localLimiter)
+		limiter.now = func() time.Time { return now }
+		interceptor := UnaryServerInterceptor(limiter, limits, WithKeyFunc(ByUser))
+
+		for i := 0; i < 2; i++ {
+			_, err := interceptor(asUser("u1"), nil, info, handler)
+			require.NoError(t, err)
+		}
+		_, err := interceptor(asUser("u1"), nil, info, handler)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		retryInfo := status.Convert(err).Details()[0].(*errdetails.RetryInfo)
+		delay, _ := ptypes.Duration(retryInfo.RetryDelay)
+		require.Equal(t, time.Second, delay)
+
+		_, err = interceptor(asUser("u2"), nil, info, handler)
+		require.NoError(t, err, "users have their own bucket")
+
+		now = now.Add(time.Second)
+		_, err = interceptor(asUser("u1"), nil, info, handler)
+		require.NoError(t, err, "a token is back after a second")
+	})
+
+	t.Run("Redis", func(t *testing.T) {
+		store := &memoryStore{local: NewLocalLimiter().(*localLimiter)}
+		interceptor := UnaryServerInterceptor(NewRedisLimiter(store, "ratelimit:"), limits)
+
+		var rejected int
+		for i := 0; i < 3; i++ {
+			if _, err := interceptor(context.Background(), nil, info, handler); status.Code(err) == codes.ResourceExhausted {
+				rejected++
+			}
+		}
+		require.Equal(t, 1, rejected, "the burst is allowed, then the rate")
+		require.Contains(t, store.keys[0], "ratelimit:")
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		interceptor := UnaryServerInterceptor(NewLocalLimiter(), NewLimits(nil))
+		for i := 0; i < 10; i++ {
+			_, err := interceptor(context.Background(), nil, info, handler)
+			require.NoError(t, err)
+		}
+	})
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := NewConcurrencyLimiter().WithLimits(2, 1, 4)
+	method := "/mwitkow.testproto.TestService/Ping"
+
+	done1, ok := limiter.Acquire(method)
+	require.True(t, ok)
+	done2, ok := limiter.Acquire(method)
+	require.True(t, ok)
+	_, ok = limiter.Acquire(method)
+	require.False(t, ok)
+
+	done1(codes.ResourceExhausted)
+	require.Equal(t, 1, limiter.Limit(method), "overload shrinks the limit")
+	_, ok = limiter.Acquire(method)
+	require.False(t, ok)
+
+	done2(codes.OK)
+	for i := 0; i < 3; i++ {
+		done, ok := limiter.Acquire(method)
+		require.True(t, ok)
+		done(codes.OK)
+	}
+	require.True(t, limiter.Limit(method) > 1, "fast successes grow the limit")
+}
+
+func TestConcurrencyLimiter_streams(t *testing.T) {
+	limiter := NewConcurrencyLimiter().WithLimits(2, 1, 4).WithStreamLimit(1)
+	method := "/mwitkow.testproto.TestService/PingList"
+
+	done, ok := limiter.AcquireStream(method)
+	require.True(t, ok)
+	_, ok = limiter.AcquireStream(method)
+	require.False(t, ok, "over the static stream limit")
+
+	done()
+	require.Equal(t, 2, limiter.Limit(method), "streams do not adapt the limit")
+	_, ok = limiter.AcquireStream(method)
+	require.True(t, ok)
+}
+
+func TestLocalLimiter_evict(t *testing.T) {
+	now := time.Now()
+	l := NewLocalLimiter().(*localLimiter)
+	l.now = func() time.Time { return now }
+
+	slow := Limit{Rate: 0.001, Burst: 2}
+	_, _, err := l.Allow("fast", Limit{Rate: 1000, Burst: 1})
+	require.NoError(t, err)
+	for i := 1; i < maxIdleBuckets; i++ {
+		now = now.Add(time.Millisecond)
+		_, _, err := l.Allow(strconv.Itoa(i), slow)
+		require.NoError(t, err)
+	}
+	require.Len(t, l.buckets, maxIdleBuckets)
+
+	now = now.Add(time.Millisecond)
+	_, _, err = l.Allow("new", slow)
+	require.NoError(t, err)
+	require.NotContains(t, l.buckets, "fast", "full under its own limit")
+	require.Len(t, l.buckets, maxIdleBuckets)
+
+	// no bucket is full, the least recently used half goes
+	now = now.Add(time.Millisecond)
+	_, _, err = l.Allow("newer", slow)
+	require.NoError(t, err)
+	require.NotContains(t, l.buckets, "1")
+	require.Contains(t, l.buckets, "new")
+	require.Len(t, l.buckets, maxIdleBuckets/2+1)
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/redis"
+)
+
+// Limiter decides whether a call counted under key may run.
+type Limiter interface {
+	// Allow takes a token for key under limit. When no token is left it
+	// returns false and how long the caller should wait before retrying.
+	Allow(key string, limit Limit) (bool, time.Duration, error)
+}
+
+// NewLocalLimiter returns a limiter keeping a token bucket per key in memory,
+// so the limits apply to each instance of the service.
+func NewLocalLimiter() Limiter {
+	return &localLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// maxIdleBuckets is the number of buckets kept before the full ones are
+// evicted, then the least recently used ones.
+const maxIdleBuckets = 10000
+
+type localLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// full reports whether the bucket is full again at now, holding no state.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.burst())
+}
+
+func (l *localLimiter) Allow(key string, limit Limit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	burst := float64(limit.burst())
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.evict(now)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// evict removes the buckets which are full again under their own limit. If
+// too many are left, the least recently used half is removed as well.
+func (l *localLimiter) evict(now time.Time) {
+	for key, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+	if len(l.buckets) < maxIdleBuckets {
+		return
+	}
+
+	keys := make([]string, 0, len(l.buckets))
+	for key := range l.buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return l.buckets[keys[i]].last.Before(l.buckets[keys[j]].last)
+	})
+	for _, key := range keys[:len(keys)-maxIdleBuckets/2] {
+		delete(l.buckets, key)
+	}
+}
+
+// NewRedisLimiter returns a limiter keeping a token bucket per key in redis,
+// so the limits apply to all the instances of the service together.
+func NewRedisLimiter(store redis.TokenTaker, keyPrefix string) Limiter {
+	return &redisLimiter{store: store, keyPrefix: keyPrefix}
+}
+
+type redisLimiter struct {
+	store     redis.TokenTaker
+	keyPrefix string
+}
+
+func (l *redisLimiter) Allow(key string, limit Limit) (bool, time.Duration, error) {
+	return l.store.TakeToken(l.keyPrefix+key, limit.Rate, limit.burst())
+}
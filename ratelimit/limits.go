@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"sync"
+)
+
+// DefaultLimit is the key of the limit applied to the methods without their
+// own limit.
+const DefaultLimit = "default"
+
+// Limit allows Rate calls per second with bursts of Burst calls. A zero Rate
+// means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// burst returns Burst, at least one.
+func (l Limit) burst() int {
+	if l.Burst < 1 {
+		return 1
+	}
+	return l.Burst
+}
+
+// Limits holds the limit of each method, keyed by full method name, e.g.
+// /payment.Payment/Pay, and a default limit keyed by DefaultLimit. It is safe
+// to update while serving.
+type Limits struct {
+	mu     sync.RWMutex
+	limits map[string]Limit
+}
+
+// NewLimits returns the limits, copied.
+func NewLimits(limits map[string]Limit) *Limits {
+	l := &Limits{}
+	l.Update(limits)
+	return l
+}
+
+// Update replaces all the limits.
+func (l *Limits) Update(limits map[string]Limit) {
+	copied := make(map[string]Limit, len(limits))
+	for method, limit := range limits {
+		copied[method] = limit
+	}
+
+	l.mu.Lock()
+	l.limits = copied
+	l.mu.Unlock()
+}
+
+// Set sets the limit of a method.
+func (l *Limits) Set(fullMethod string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	copied := make(map[string]Limit, len(l.limits)+1)
+	for method, limit := range l.limits {
+		copied[method] = limit
+	}
+	copied[fullMethod] = limit
+	l.limits = copied
+}
+
+// For returns the limit of fullMethod, or else the default limit. It reports
+// false when the method is not limited.
+func (l *Limits) For(fullMethod string) (Limit, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	limit, ok := l.limits[fullMethod]
+	if !ok {
+		limit, ok = l.limits[DefaultLimit]
+	}
+	return limit, ok && limit.Rate > 0
+}
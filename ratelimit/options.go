@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/auth"
+	"github.com/richard-xtek/go-grpc-micro-kit/auth/requestinfo"
+)
+
+var (
+	defaultOptions = &options{
+		keyFunc:  ByMethod,
+		failOpen: true,
+	}
+)
+
+type options struct {
+	keyFunc  KeyFunc
+	failOpen bool
+}
+
+func evaluateOpt(opts []Option) *options {
+	optCopy := &options{}
+	*optCopy = *defaultOptions
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// Option ...
+type Option func(*options)
+
+// KeyFunc returns who a call is counted for. The calls of a method with the
+// same key share a token bucket.
+type KeyFunc func(ctx context.Context, fullMethod string) string
+
+// WithKeyFunc customizes who the calls are counted for. By default all the
+// calls of a method share a bucket.
+func WithKeyFunc(f KeyFunc) Option {
+	return func(o *options) {
+		o.keyFunc = f
+	}
+}
+
+// WithFailOpen decides whether calls run when the limiter fails, e.g. when
+// redis is down. It is true by default.
+func WithFailOpen(failOpen bool) Option {
+	return func(o *options) {
+		o.failOpen = failOpen
+	}
+}
+
+// ByMethod counts all the calls of a method together.
+func ByMethod(ctx context.Context, fullMethod string) string {
+	return ""
+}
+
+// ByUser counts the calls per requestinfo.RequestInfo.UserID. The anonymous
+// calls share a bucket.
+func ByUser(ctx context.Context, fullMethod string) string {
+	if info, ok := requestinfo.ExtractRequestInfo(ctx); ok && info != nil {
+		return info.UserID
+	}
+	return ""
+}
+
+// ByClientIP counts the calls per requestinfo.RequestInfo.ClientIP.
+func ByClientIP(ctx context.Context, fullMethod string) string {
+	if info, ok := requestinfo.ExtractRequestInfo(ctx); ok && info != nil {
+		return info.ClientIP
+	}
+	return ""
+}
+
+// ByProvider counts the calls per auth.ServiceProviderClaim.ID, set by
+// requestinfo.Authentication for the authenticated services only.
+func ByProvider(ctx context.Context, fullMethod string) string {
+	if claim, ok := auth.ProviderFromContext(ctx); ok {
+		return claim.ID
+	}
+	return ""
+}
@@ -20,6 +20,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/handlers"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
 	"github.com/sirupsen/logrus"
 )
 
@@ -38,3 +39,19 @@ func NewRecoveryHandler(logger *logrus.Entry, printStack bool) func(h http.Handl
 	zWrapper := recoveryWrapper{logger}
 	return handlers.RecoveryHandler(handlers.RecoveryLogger(zWrapper), handlers.PrintRecoveryStack(printStack))
 }
+
+// logWrapper wraps a log.Logger into a gorilla RecoveryLogger
+type logWrapper struct {
+	logger log.Logger
+}
+
+// Println logs an error message with the given fields
+func (z logWrapper) Println(args ...interface{}) {
+	z.logger.Error(fmt.Sprint(args...))
+}
+
+// NewLogRecoveryHandler returns an http.Handler that recovers on panics and logs them to logger
+func NewLogRecoveryHandler(logger log.Logger, printStack bool) func(h http.Handler) http.Handler {
+	zWrapper := logWrapper{logger}
+	return handlers.RecoveryHandler(handlers.RecoveryLogger(zWrapper), handlers.PrintRecoveryStack(printStack))
+}
@@ -25,17 +25,64 @@ type Store interface {
 	Del(keys ...string) error
 }
 
+// NXSetter is implemented by stores that can set a key only if it does not
+// exist, such as the Store returned by New.
+type NXSetter interface {
+	SetStringNX(k string, v string, ttl int) (bool, error)
+}
+
+// Locker is implemented by stores that can hold a lock, a key set to the
+// token of its owner, such as the Store returned by New. A lock is refreshed
+// and released only while it still holds the owner's token, so an owner whose
+// lock expired does not touch the lock taken by the next one.
+type Locker interface {
+	NXSetter
+	ExpireIfEqual(k string, v string, ttl int) (bool, error)
+	DelIfEqual(k string, v string) (bool, error)
+}
+
+// Incrementer is implemented by stores with expiring counters, such as the
+// Store returned by New.
+type Incrementer interface {
+	IncrWithTTL(k string, ttl int) (int64, error)
+}
+
+// TokenTaker is implemented by stores keeping token buckets, such as the
+// Store returned by New.
+type TokenTaker interface {
+	// TakeToken takes a token from the bucket k, refilled with rate tokens per
+	// second up to burst. When no token is left it returns false and the wait
+	// until one is.
+	TakeToken(k string, rate float64, burst int) (bool, time.Duration, error)
+}
+
+// Pinger is implemented by stores that can check the connection to the
+// server, such as the Store returned by New.
+type Pinger interface {
+	Ping() error
+}
+
+// Client is the Store returned by New, with the optional capabilities of a
+// redis server.
+type Client interface {
+	Store
+	Locker
+	Incrementer
+	TokenTaker
+	Pinger
+}
+
 type redisStore struct {
 	pool *redis.Pool
 }
 
 // New returns new Store
-func New(pool *redis.Pool) Store {
+func New(pool *redis.Pool) Client {
 	return &redisStore{pool: pool}
 }
 
 // NewWithPool returns new Redis Store with default pool config
-func NewWithPool(address string) Store {
+func NewWithPool(address string) Client {
 	redisPool := &redis.Pool{
 		MaxIdle:     50,
 		MaxActive:   0,
@@ -116,6 +163,50 @@ func (r redisStore) SetStringWithTTL(k string, v string, ttl int) error {
 	return err
 }
 
+// SetStringNX sets k only if it does not exist and reports whether it did.
+// ttl: time in second
+func (r redisStore) SetStringNX(k string, v string, ttl int) (bool, error) {
+	c := r.pool.Get()
+	defer c.Close()
+
+	_, err := redis.String(c.Do("SET", k, v, "EX", ttl, "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+var (
+	expireIfEqual = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("EXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	delIfEqual = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// ExpireIfEqual resets the ttl of k if k holds v and reports whether it did.
+// ttl: time in second
+func (r redisStore) ExpireIfEqual(k string, v string, ttl int) (bool, error) {
+	c := r.pool.Get()
+	defer c.Close()
+
+	return redis.Bool(expireIfEqual.Do(c, k, v, ttl))
+}
+
+// DelIfEqual deletes k if k holds v and reports whether it did.
+func (r redisStore) DelIfEqual(k string, v string) (bool, error) {
+	c := r.pool.Get()
+	defer c.Close()
+
+	return redis.Bool(delIfEqual.Do(c, k, v))
+}
+
 func (r redisStore) GetString(k string) (string, error) {
 	c := r.pool.Get()
 	defer c.Close()
@@ -174,6 +265,63 @@ func (r redisStore) GetTTL(k string) (int, error) {
 	return result, err
 }
 
+var incrWithTTL = redis.NewScript(1, `
+local n = redis.call("INCR", KEYS[1])
+if redis.call("TTL", KEYS[1]) == -1 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return n`)
+
+// IncrWithTTL increments the counter k and returns its new value. The ttl is
+// set when the counter is created, in the same script so that no counter is
+// left without one.
+// ttl: time in second
+func (r redisStore) IncrWithTTL(k string, ttl int) (int64, error) {
+	c := r.pool.Get()
+	defer c.Close()
+
+	return redis.Int64(incrWithTTL.Do(c, k, ttl))
+}
+
+// takeToken refills the bucket for the time elapsed on the clock of the
+// server, shared by the clients, then takes a token. It returns whether it
+// did and the wait in milliseconds until a token is back.
+var takeToken = redis.NewScript(1, `
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(bucket[1]) or burst
+local last = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+
+local taken, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000))
+return {taken, wait}`)
+
+// TakeToken takes a token from the bucket k, refilled with rate tokens per
+// second up to burst. The bucket expires once full again.
+func (r redisStore) TakeToken(k string, rate float64, burst int) (bool, time.Duration, error) {
+	c := r.pool.Get()
+	defer c.Close()
+
+	result, err := redis.Int64s(takeToken.Do(c, k, rate, burst))
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
 func (r redisStore) IsExist(k string) bool {
 	s, _ := r.GetString(k)
 	return s != ""
@@ -192,3 +340,11 @@ func (r redisStore) Del(keys ...string) error {
 
 	return err
 }
+
+func (r redisStore) Ping() error {
+	c := r.pool.Get()
+	defer c.Close()
+
+	_, err := c.Do("PING")
+	return err
+}
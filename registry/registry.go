@@ -1,12 +1,16 @@
 package registry
 
 import (
-	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/consul/api"
 	consul "github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
 )
 
 // NewClient returns a new Client with connection to consul
@@ -22,14 +26,28 @@ func NewClient(addr string) (*consul.Client, error) {
 	return c, nil
 }
 
-// ConsulRegister ...
+// ConsulRegister registers a service in Consul through the discovery.Consul
+// configured by its fields.
 type ConsulRegister struct {
 	ServiceName                    string   // service name
 	Tags                           []string // consul tags
 	ServicePort                    int      //service port
 	DeregisterCriticalServiceAfter time.Duration
 	Interval                       time.Duration
-	Client                         *consul.Client
+	// TTL checks the service by a heartbeat instead of the gRPC health
+	// service when set, see discovery.Consul.WithTTLCheck
+	TTL    time.Duration
+	Client *consul.Client
+	// Address is the advertised address of the service, LocalIP when empty
+	Address string
+	// Meta is the service metadata, e.g. the zone, weight, version and canary
+	// flag of grpc_resolver.Metadata.Map()
+	Meta map[string]string
+	// Logger logs the registrations kept by Register, none when nil
+	Logger log.Factory
+
+	once     sync.Once
+	registry *discovery.Consul
 }
 
 // NewConsulRegister ...
@@ -38,47 +56,93 @@ func NewConsulRegister(consulClient *consul.Client, serviceName string, serviceP
 		ServiceName:                    serviceName,
 		Tags:                           tags,
 		ServicePort:                    servicePort,
-		DeregisterCriticalServiceAfter: time.Duration(1) * time.Minute,
-		Interval:                       time.Duration(10) * time.Second,
+		DeregisterCriticalServiceAfter: discovery.DefaultDeregisterAfter,
+		Interval:                       discovery.DefaultCheckInterval,
 		Client:                         consulClient,
 	}
 }
 
-// Register ...
-func (r *ConsulRegister) Register() (string, error) {
+// WithLogger returns a copy of the registration logging with logger, r is
+// left unchanged.
+func (r *ConsulRegister) WithLogger(logger log.Factory) *ConsulRegister {
+	return &ConsulRegister{
+		ServiceName:                    r.ServiceName,
+		Tags:                           r.Tags,
+		ServicePort:                    r.ServicePort,
+		DeregisterCriticalServiceAfter: r.DeregisterCriticalServiceAfter,
+		Interval:                       r.Interval,
+		TTL:                            r.TTL,
+		Client:                         r.Client,
+		Address:                        r.Address,
+		Meta:                           r.Meta,
+		Logger:                         logger,
+	}
+}
 
-	IP := localIP()
-	reg := &api.AgentServiceRegistration{
-		ID:      fmt.Sprintf("%v-%v-%v", r.ServiceName, IP, r.ServicePort),
-		Name:    r.ServiceName,
-		Tags:    r.Tags,
+// Registry returns the registry of the service, configured by the fields on
+// the first call.
+func (r *ConsulRegister) Registry() *discovery.Consul {
+	r.once.Do(func() {
+		logger := r.Logger
+		if logger == (log.Factory{}) {
+			logger = log.NewFactory(zap.NewNop())
+		}
+		r.registry = discovery.NewConsul(r.Client, logger).
+			WithCheck(r.Interval, r.DeregisterCriticalServiceAfter).
+			WithTTLCheck(r.TTL).
+			WithAdvertiseAddress(r.Address)
+	})
+	return r.registry
+}
+
+// Instance returns the registered instance of the service.
+func (r *ConsulRegister) Instance() discovery.Instance {
+	instance := discovery.Instance{
+		Service: r.ServiceName,
+		Address: LocalIP(),
 		Port:    r.ServicePort,
-		Address: IP,
-		Check: &api.AgentServiceCheck{
-			Interval:                       r.Interval.String(),
-			GRPC:                           fmt.Sprintf("%v:%v/%v", IP, r.ServicePort, r.ServiceName),
-			DeregisterCriticalServiceAfter: r.DeregisterCriticalServiceAfter.String(),
-		},
+		Tags:    r.Tags,
+		Meta:    r.Meta,
 	}
-	return reg.ID, r.Client.Agent().ServiceRegister(reg)
+	instance = r.Registry().Advertise(instance)
+	instance.ID = discovery.InstanceID(instance)
+	return instance
+}
+
+// Register registers the service and keeps it registered until Deregister.
+func (r *ConsulRegister) Register() (string, error) {
+	instance := r.Instance()
+	return instance.ID, r.Registry().Register(instance)
+}
+
+// Status returns the aggregated health status and the checks of the
+// registered service from the local agent.
+func (r *ConsulRegister) Status(id string) (string, *api.AgentServiceChecksInfo, error) {
+	return r.Client.Agent().AgentHealthServiceByID(id)
 }
 
 // Deregister removes the service address from registry
 func (r *ConsulRegister) Deregister(id string) error {
-	return r.Client.Agent().ServiceDeregister(id)
+	return r.Registry().Deregister(discovery.Instance{ID: id})
 }
 
-func localIP() string {
+// LocalIP returns the first non loopback IPv4 address of the host, or else
+// its first global IPv6 address.
+func LocalIP() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return ""
 	}
+	ipv6 := ""
 	for _, address := range addrs {
 		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 			if ipnet.IP.To4() != nil {
 				return ipnet.IP.String()
 			}
+			if ipv6 == "" && ipnet.IP.IsGlobalUnicast() {
+				ipv6 = ipnet.IP.String()
+			}
 		}
 	}
-	return ""
+	return ipv6
 }
@@ -2,33 +2,41 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"expvar"
 	"fmt"
 	"net"
 	"net/http"
-	"runtime/debug"
-
-	"github.com/richard-xtek/go-grpc-micro-kit/tracing"
-
-	"github.com/richard-xtek/go-grpc-micro-kit/auth/requestinfo"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	grpc_logf "github.com/richard-xtek/go-grpc-micro-kit/grpc-logf"
 	"go.uber.org/zap"
 
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	grpc_resolver "github.com/richard-xtek/go-grpc-micro-kit/grpc-resolver"
+	"github.com/richard-xtek/go-grpc-micro-kit/health"
 	"github.com/richard-xtek/go-grpc-micro-kit/log"
 	"github.com/richard-xtek/go-grpc-micro-kit/registry"
+	"github.com/richard-xtek/go-grpc-micro-kit/tlsconfig"
 
-	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
-	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
-	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
-	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	opentracing "github.com/opentracing/opentracing-go"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
+const (
+	// DefaultShutdownTimeout is how long Stop waits for in-flight RPCs to drain
+	// when the given context has no deadline.
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
 // GRPCRegister ...
 type GRPCRegister func(server *grpc.Server)
 
@@ -36,8 +44,8 @@ type GRPCRegister func(server *grpc.Server)
 func NewGRPCServer(logger log.Factory, name string) *GRPCServer {
 	s := &GRPCServer{logger: logger}
 	s.name = name
-
-	s.quite = make(chan bool)
+	s.shutdownTimeout = DefaultShutdownTimeout
+	s.health = health.NewServer(logger)
 
 	return s
 }
@@ -50,17 +58,43 @@ type GRPCServer struct {
 
 	logger log.Factory
 	server *grpc.Server
+	health *health.Server
 
+	// lifecycle serializes Start and Stop, mu guards the state read while
+	// they run
+	lifecycle  sync.Mutex
+	mu         sync.Mutex
 	didStarted bool
 	quite      chan bool
+	serveErr   error
+
+	shutdownTimeout time.Duration
 
 	grpcRegister GRPCRegister
 
 	grpcUnaryInterceptors  []grpc.UnaryServerInterceptor
 	grpcStreamInterceptors []grpc.StreamServerInterceptor
+	interceptors           interceptorConfig
+	serverOptions          []grpc.ServerOption
+
+	tracer   opentracing.Tracer
+	consul   *registry.ConsulRegister
+	consulID string
+
+	registry discovery.Registry
+	instance discovery.Instance
+	meta     map[string]string
 
-	tracer opentracing.Tracer
-	consul *registry.ConsulRegister
+	httpServer *HTTPServer
+	mux        *listenerMux
+
+	tlsCertFile string
+	tlsKeyFile  string
+	tlsCAFile   string
+	tls         *tlsconfig.Reloader
+
+	// addr is the address of the listener served, guarded by mu
+	addr net.Addr
 }
 
 // WithUnaryServerInterceptor ...
@@ -69,6 +103,20 @@ func (s *GRPCServer) WithUnaryServerInterceptor(usi grpc.UnaryServerInterceptor)
 	return s
 }
 
+// WithStreamServerInterceptor ...
+func (s *GRPCServer) WithStreamServerInterceptor(ssi grpc.StreamServerInterceptor) *GRPCServer {
+	s.grpcStreamInterceptors = append(s.grpcStreamInterceptors, ssi)
+	return s
+}
+
+// WithServerOption adds options such as keepalive, message size limits or
+// compression to the grpc.Server. Interceptors must be added through the
+// interceptor methods instead of grpc.UnaryInterceptor/StreamInterceptor.
+func (s *GRPCServer) WithServerOption(opts ...grpc.ServerOption) *GRPCServer {
+	s.serverOptions = append(s.serverOptions, opts...)
+	return s
+}
+
 // WithPort ...
 func (s *GRPCServer) WithPort(port string) *GRPCServer {
 	s.port = port
@@ -87,9 +135,85 @@ func (s *GRPCServer) WithTracer(tracer opentracing.Tracer) *GRPCServer {
 	return s
 }
 
-// WithConsul ...
+// WithConsul registers the server in Consul as configured by consul, see
+// registry.ConsulRegister.Registry. A TTL heartbeat reports the serving
+// status of the health server. The server keeps its own copy of consul.
 func (s *GRPCServer) WithConsul(consul *registry.ConsulRegister) *GRPCServer {
+	logger := consul.Logger
+	if logger == (log.Factory{}) {
+		logger = s.logger
+	}
+	consul = consul.WithLogger(logger)
 	s.consul = consul
+	s.registry = consul.Registry().WithHealth(s.health)
+	// advertised by the registry
+	s.instance = discovery.Instance{
+		Service: consul.ServiceName,
+		Port:    consul.ServicePort,
+		Tags:    consul.Tags,
+		Meta:    consul.Meta,
+	}
+	return s
+}
+
+// WithRegistry registers the server in r with tags while it serves. The
+// instance is named after the server and its listening port.
+func (s *GRPCServer) WithRegistry(r discovery.Registry, tags ...string) *GRPCServer {
+	s.registry = r
+	s.instance = discovery.Instance{Tags: tags}
+	return s
+}
+
+// WithMetadata registers the server with the zone, weight, version and
+// canary flag of md, unless its registration has its own metadata.
+func (s *GRPCServer) WithMetadata(md grpc_resolver.Metadata) *GRPCServer {
+	s.meta = md.Map()
+	return s
+}
+
+// WithHTTPServer serves the HTTP server on the same port as gRPC. Connections
+// are split by content type: HTTP/2 connections whose first request is
+// application/grpc reach the gRPC server, everything else, including HTTP/1.1
+// connections upgraded to h2c, reaches the HTTP server. When the
+// HTTP server has no gRPC endpoint it proxies to this server. Start and Stop
+// also start and stop the HTTP server.
+func (s *GRPCServer) WithHTTPServer(httpServer *HTTPServer) *GRPCServer {
+	s.httpServer = httpServer
+	return s
+}
+
+// WithTLS serves over TLS with the given certificate key pair. The files are
+// reloaded when they change.
+func (s *GRPCServer) WithTLS(certFile, keyFile string) *GRPCServer {
+	s.tlsCertFile = certFile
+	s.tlsKeyFile = keyFile
+	s.tls = nil
+	return s
+}
+
+// WithMTLS serves over mutual TLS: clients must present a certificate signed
+// by a CA of caFile. The verified client identity is available to handlers
+// through tlsconfig.FromContext. The files are reloaded when they change.
+func (s *GRPCServer) WithMTLS(certFile, keyFile, caFile string) *GRPCServer {
+	s.tlsCertFile = certFile
+	s.tlsKeyFile = keyFile
+	s.tlsCAFile = caFile
+	s.tls = nil
+	return s
+}
+
+// WithShutdownTimeout sets how long Stop waits for in-flight RPCs to finish
+// before forcing the server to stop. It only applies when the context passed
+// to Stop has no deadline.
+func (s *GRPCServer) WithShutdownTimeout(timeout time.Duration) *GRPCServer {
+	s.shutdownTimeout = timeout
+	return s
+}
+
+// WithHealthChecker registers a dependency checker on the health service.
+// Use health.Critical to report NOT_SERVING while the dependency fails.
+func (s *GRPCServer) WithHealthChecker(name string, checker health.Checker, opts ...health.CheckOption) *GRPCServer {
+	s.health.Register(name, checker, opts...)
 	return s
 }
 
@@ -99,48 +223,26 @@ func (s *GRPCServer) WithHandler(handler GRPCRegister) *GRPCServer {
 	return s
 }
 
-func (s *GRPCServer) recoveryHandler(ctx context.Context, p interface{}) error {
-	logger := grpc_logf.Extract(ctx)
-	logger.For(ctx).Error("Recovery catched", zap.String("p", fmt.Sprintf("%v", p)))
-	tracing.WriteLogGRPCMessage(ctx, true)
-	debug.PrintStack()
-	return grpc.Errorf(98888, "The system is busy, please try again later")
-}
-
 func (s *GRPCServer) makeServer() {
-	alwaysLoggingDeciderServer := func(ctx context.Context, fullMethodName string, servingObject interface{}) bool { return true }
-
-	sIntOpt := grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-		grpc_ctxtags.StreamServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
-		grpc_opentracing.StreamServerInterceptor(grpc_opentracing.WithTracer(s.tracer)),
-		grpc_prometheus.StreamServerInterceptor,
-		grpc_logf.StreamServerInterceptor(s.logger),
-		grpc_logf.PayloadStreamServerInterceptor(s.logger, alwaysLoggingDeciderServer),
-		grpc_recovery.StreamServerInterceptor(),
-		grpc_middleware.ChainStreamServer(s.grpcStreamInterceptors...),
-	))
-
-	uIntOpt := grpc.UnaryInterceptor(
-		grpc_middleware.ChainUnaryServer(
-			requestinfo.UnaryServerAuth(requestinfo.Authentication(s.logger)),
-			grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
-			grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(s.tracer), grpc_opentracing.WithFilterFunc(func(ctx context.Context, fullMethodName string) bool {
-				if fullMethodName == "/grpc.health.v1.Health/Check" {
-					return false
-				}
-				return true
-			})),
-			grpc_prometheus.UnaryServerInterceptor,
-			grpc_logf.UnaryServerInterceptor(s.logger),
-			grpc_logf.PayloadUnaryServerInterceptor(s.logger, alwaysLoggingDeciderServer),
-			grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(s.recoveryHandler)),
-			grpc_middleware.ChainUnaryServer(s.grpcUnaryInterceptors...),
-		),
-	)
-	s.server = grpc.NewServer(
-		sIntOpt,
-		uIntOpt,
-	)
+	opts := []grpc.ServerOption{
+		grpc.StreamInterceptor(s.streamInterceptorChain()),
+		grpc.UnaryInterceptor(s.unaryInterceptorChain()),
+	}
+	if s.tls != nil {
+		if s.httpServer != nil {
+			// the shared listener terminates TLS
+			opts = append(opts, grpc.Creds(tlsconfig.NewTerminatedCredentials()))
+		} else {
+			opts = append(opts, grpc.Creds(tlsconfig.NewServerCredentials(s.tls)))
+		}
+	}
+
+	opts = append(opts, s.serverOptions...)
+
+	server := grpc.NewServer(opts...)
+	s.mu.Lock()
+	s.server = server
+	s.mu.Unlock()
 }
 
 // EnablePrometheus ...
@@ -166,61 +268,330 @@ func (s *GRPCServer) GetAddressListen() string {
 	return fmt.Sprintf("%s:%s", s.host, s.port)
 }
 
+// Health returns the grpc.health.v1 server registered on this server.
+func (s *GRPCServer) Health() *health.Server {
+	return s.health
+}
+
+// GetDialAddress returns an address clients on the same host can dial: the
+// one of the listener served once started, else the configured one.
+func (s *GRPCServer) GetDialAddress() string {
+	s.mu.Lock()
+	addr := s.addr
+	s.mu.Unlock()
+
+	host, port := s.host, s.port
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		host, port = "", strconv.Itoa(tcp.Port)
+		if tcp.IP != nil {
+			host = tcp.IP.String()
+		}
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// GetConsul ...
+func (s *GRPCServer) GetConsul() *registry.ConsulRegister {
+	return s.consul
+}
+
+// registryInstance returns the instance registered for the server listening
+// on l, completing the configured one.
+func (s *GRPCServer) registryInstance(l net.Listener) discovery.Instance {
+	instance := s.instance
+	if instance.Service == "" {
+		instance.Service = s.name
+	}
+	if instance.Port == 0 {
+		if addr, ok := l.Addr().(*net.TCPAddr); ok {
+			instance.Port = addr.Port
+		}
+	}
+	if instance.Address == "" {
+		instance.Address = registry.LocalIP()
+	}
+	if advertiser, ok := s.registry.(discovery.Advertiser); ok {
+		instance = advertiser.Advertise(instance)
+	}
+	if instance.Meta == nil {
+		instance.Meta = s.meta
+	}
+	if instance.ID == "" {
+		instance.ID = discovery.InstanceID(instance)
+	}
+	return instance
+}
+
+// GetConsulID returns the registered instance ID, empty when not registered.
+func (s *GRPCServer) GetConsulID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.consulID
+}
+
 // GetServer ...
 func (s *GRPCServer) GetServer() *grpc.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.server
 }
 
 // Start ...
 func (s *GRPCServer) Start() error {
-	return s.start()
+	return s.start(nil)
+}
+
+// Serve starts the server like Start but accepts connections on l instead
+// of listening on the configured host and port, e.g. on a bufconn listener
+// in tests. The server closes l when it stops.
+func (s *GRPCServer) Serve(l net.Listener) error {
+	return s.start(l)
 }
 
-func (s *GRPCServer) start() error {
+func (s *GRPCServer) start(ln net.Listener) error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	s.mu.Lock()
+	started := s.didStarted
+	s.mu.Unlock()
+	if started {
+		return fmt.Errorf("%s GRPC Server already started", s.name)
+	}
+
+	if s.tlsCertFile != "" && s.tls == nil {
+		// kept across restarts, it reloads the files itself
+		r, err := tlsconfig.NewReloader(s.tlsCertFile, s.tlsKeyFile, s.tlsCAFile)
+		if err != nil {
+			return err
+		}
+		s.tls = r
+	}
+
 	// create grpc server
 	s.makeServer()
 
-	ln, err := net.Listen("tcp", s.GetAddressListen())
-	if err != nil {
-		return err
+	if ln == nil {
+		var err error
+		if ln, err = net.Listen("tcp", s.GetAddressListen()); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.addr = ln.Addr()
+	s.mu.Unlock()
+
+	if s.httpServer != nil {
+		if s.tls != nil {
+			// http/1.1 first: clients offering both reach the HTTP server,
+			// gRPC clients only offer h2
+			ln = tls.NewListener(ln, s.tls.ServerConfig("http/1.1", "h2"))
+		}
+		s.mux = newListenerMux(ln)
+		ln = s.mux.grpc
+
+		s.httpServer.h2c = true
+		if s.httpServer.grpcEndpoint == "" {
+			s.httpServer.WithGRPCEndpoint(s.GetDialAddress())
+			if s.tls != nil && s.httpServer.dialCreds == nil {
+				// dial ourselves with our own certificate, verified against
+				// a name it is valid for rather than the dialed localhost
+				s.httpServer.WithDialCredentials(tlsconfig.NewClientCredentials(s.tls, s.tls.ServerName()))
+			}
+		}
+		if err := s.httpServer.serveWithListener(s.mux.http); err != nil {
+			s.mux.Close()
+			return err
+		}
+		go s.mux.serve()
 	}
 
 	s.logger.Bg().Info("Starting " + s.name + " GRPC Server on port " + s.port)
 	if err := s.serveWithListener(ln); err != nil {
 		return err
 	}
+	s.mu.Lock()
+	s.didStarted = true
+	s.mu.Unlock()
 	s.logger.Bg().Info("Started " + s.name + " GRPC Server on port " + s.port)
 
 	return nil
 }
 
 func (s *GRPCServer) serveWithListener(l net.Listener) error {
-	go func() {
-		if s.consul != nil {
-			id, err := s.consul.Register()
-			if err != nil {
-				// s.logger.WithError(err).Fatal("Consul register")
-			}
-			defer func() {
-				if err := s.consul.Deregister(id); err != nil {
-					// s.logger.WithError(err).Error("Deregister consul")
-				}
-			}()
+	s.grpcRegister(s.server)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	reflection.Register(s.server)
+	grpc_prometheus.Register(s.server)
+
+	// consul checks the health of the service by its registered name
+	s.health.AddService(s.name)
+	for service := range s.server.GetServiceInfo() {
+		s.health.AddService(service)
+	}
+	s.health.Start()
+
+	if s.registry != nil {
+		instance := s.registryInstance(l)
+		if err := s.registry.Register(instance); err != nil {
+			s.logger.Bg().Error("Register "+s.name+" GRPC Server", zap.String("id", instance.ID), zap.Error(err))
 		}
+		// deregistered on Stop even when failed, a registry may retry it
+		s.mu.Lock()
+		s.instance = instance
+		s.consulID = instance.ID
+		s.mu.Unlock()
+	}
 
-		s.grpcRegister(s.server)
-		reflection.Register(s.server)
-		grpc_prometheus.Register(s.server)
+	server := s.server
+	s.mu.Lock()
+	s.serveErr = nil
+	quite := s.quitChan()
+	s.mu.Unlock()
 
-		err := s.server.Serve(l)
+	go func() {
+		err := server.Serve(l)
 		if err != nil {
-			// s.logger.WithError(err).Error()
+			s.logger.Bg().Error("Serve "+s.name+" GRPC Server", zap.Error(err))
 		}
+
+		s.mu.Lock()
+		s.serveErr = err
+		s.mu.Unlock()
+		close(quite)
 	}()
 	return nil
 }
 
-// Stop ...
-func (s *GRPCServer) Stop() error {
-	return nil
+// quitChan returns the channel closed when the current or next serving
+// session ends. s.mu must be held.
+func (s *GRPCServer) quitChan() chan bool {
+	if s.quite == nil {
+		s.quite = make(chan bool)
+	}
+	return s.quite
+}
+
+// Done returns a channel that is closed once the server stops serving. Before
+// Start, or after Stop, it is closed when the next serving session stops.
+func (s *GRPCServer) Done() <-chan bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quitChan()
+}
+
+// Stop gracefully shuts the server down. It marks every service as
+// NOT_SERVING, deregisters from Consul so no new traffic is routed here, and
+// waits for in-flight unary and stream RPCs to drain. If ctx expires first
+// (or the shutdown timeout elapses when ctx has no deadline) the remaining
+// RPCs are cancelled and ctx.Err() is returned.
+func (s *GRPCServer) Stop(ctx context.Context) error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	// getters such as GetConsulID only need mu, which is not held while
+	// draining
+	s.mu.Lock()
+	started := s.didStarted
+	s.didStarted = false
+	instance, consulID := s.instance, s.consulID
+	s.consulID = ""
+	quite := s.quitChan()
+	s.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	if _, ok := ctx.Deadline(); !ok && s.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+	}
+
+	s.logger.Bg().Info("Stopping " + s.name + " GRPC Server")
+	s.health.Shutdown()
+
+	if s.registry != nil && consulID != "" {
+		if err := s.registry.Deregister(instance); err != nil {
+			s.logger.Bg().Error("Deregister "+s.name+" GRPC Server", zap.String("id", consulID), zap.Error(err))
+		}
+	}
+
+	var httpErr error
+	httpStopped := make(chan struct{})
+	go func() {
+		if s.httpServer != nil {
+			httpErr = s.httpServer.Stop(ctx)
+		}
+		close(httpStopped)
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	var err error
+	select {
+	case <-stopped:
+		s.logger.Bg().Info("Stopped " + s.name + " GRPC Server")
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.logger.Bg().Warn("Force stopping "+s.name+" GRPC Server", zap.Error(err))
+		s.server.Stop()
+		<-stopped
+	}
+
+	<-httpStopped
+	if s.mux != nil {
+		s.mux.Close()
+		s.mux = nil
+	}
+	if err == nil {
+		err = httpErr
+	}
+
+	// wait for the serve goroutine, then start a new session so the server
+	// can be started again
+	<-quite
+	s.mu.Lock()
+	s.quite = nil
+	s.mu.Unlock()
+
+	return err
+}
+
+// Run starts the server and blocks until SIGINT or SIGTERM is received or the
+// server stops serving on its own, then shuts it down gracefully. In both
+// cases the server leaves the registry before Run returns.
+func (s *GRPCServer) Run() error {
+	// listen to signals first so none is missed while starting
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	select {
+	case c := <-sig:
+		s.logger.Bg().Info("Received signal " + c.String())
+		return s.Stop(context.Background())
+	case <-s.Done():
+	}
+
+	err := s.Stop(context.Background())
+	s.mu.Lock()
+	serveErr := s.serveErr
+	s.mu.Unlock()
+	if serveErr != nil {
+		return serveErr
+	}
+	return err
 }
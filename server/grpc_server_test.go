@@ -0,0 +1,222 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/richard-xtek/go-grpc-micro-kit/discovery"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/registry"
+	"github.com/richard-xtek/go-grpc-micro-kit/server"
+	"github.com/richard-xtek/go-grpc-micro-kit/servertest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// blockingService blocks Ping until release is closed or the call is
+// cancelled.
+type blockingService struct {
+	pb_testproto.TestServiceServer
+
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingService() *blockingService {
+	return &blockingService{entered: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (s *blockingService) Ping(ctx context.Context, req *pb_testproto.PingRequest) (*pb_testproto.PingResponse, error) {
+	s.entered <- struct{}{}
+	select {
+	case <-s.release:
+		return &pb_testproto.PingResponse{Value: req.Value}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestGRPCServer_Stop(t *testing.T) {
+	start := func(t *testing.T, service *blockingService) (*servertest.Server, *discovery.Memory) {
+		registry := discovery.NewMemory()
+		s := servertest.NewServer(func(server *grpc.Server) {
+			pb_testproto.RegisterTestServiceServer(server, service)
+		})
+		s.GRPCServer().WithRegistry(registry)
+		require.NoError(t, s.Start())
+		require.Len(t, registry.Instances("servertest"), 1)
+		return s, registry
+	}
+
+	t.Run("Drain", func(t *testing.T) {
+		service := newBlockingService()
+		s, registry := start(t, service)
+		defer s.Close()
+
+		pingErr := make(chan error, 1)
+		go func() {
+			_, err := pb_testproto.NewTestServiceClient(s.Conn()).Ping(context.Background(), &pb_testproto.PingRequest{Value: "ping"})
+			pingErr <- err
+		}()
+		<-service.entered
+
+		done := s.GRPCServer().Done()
+		stopErr := make(chan error, 1)
+		go func() {
+			stopErr <- s.GRPCServer().Stop(context.Background())
+		}()
+
+		// deregistered before the in-flight call finishes
+		require.Eventually(t, func() bool { return len(registry.Instances("servertest")) == 0 }, time.Second, 5*time.Millisecond)
+		require.Empty(t, s.GRPCServer().GetConsulID(), "getters are not blocked while draining")
+		select {
+		case <-done:
+			t.Fatal("stopped before the in-flight call finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(service.release)
+		require.NoError(t, <-pingErr)
+		require.NoError(t, <-stopErr)
+		<-done
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		service := newBlockingService()
+		s, _ := start(t, service)
+		defer s.Close()
+
+		pingErr := make(chan error, 1)
+		go func() {
+			_, err := pb_testproto.NewTestServiceClient(s.Conn()).Ping(context.Background(), &pb_testproto.PingRequest{Value: "ping"})
+			pingErr <- err
+		}()
+		<-service.entered
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.Equal(t, context.DeadlineExceeded, s.GRPCServer().Stop(ctx))
+		require.Error(t, <-pingErr)
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		service := newBlockingService()
+		close(service.release)
+		s, _ := start(t, service)
+
+		require.NoError(t, s.Close())
+		done := s.GRPCServer().Done()
+		require.NoError(t, s.Start())
+
+		_, err := pb_testproto.NewTestServiceClient(s.Conn()).Ping(context.Background(), &pb_testproto.PingRequest{Value: "ping"})
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+		<-done
+	})
+}
+
+func TestGRPCServer_Run(t *testing.T) {
+	run := func(t *testing.T) (*server.GRPCServer, *discovery.Memory, chan error) {
+		registry := discovery.NewMemory()
+		s := server.NewGRPCServer(log.NewFactory(zap.NewNop()), "test").
+			WithHost("127.0.0.1").
+			WithPort("0").
+			WithRegistry(registry).
+			WithHandler(func(*grpc.Server) {})
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- s.Run()
+		}()
+		require.Eventually(t, func() bool { return len(registry.Instances("test")) == 1 }, time.Second, 5*time.Millisecond)
+		return s, registry, runErr
+	}
+
+	t.Run("Signal", func(t *testing.T) {
+		_, registry, runErr := run(t)
+
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+		select {
+		case err := <-runErr:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run did not return")
+		}
+		require.Empty(t, registry.Instances("test"))
+	})
+
+	t.Run("ServeExit", func(t *testing.T) {
+		s, registry, runErr := run(t)
+
+		s.GetServer().Stop()
+		select {
+		case err := <-runErr:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run did not return")
+		}
+		require.Empty(t, registry.Instances("test"), "deregistered when serving stops on its own")
+	})
+}
+
+func TestGRPCServer_WithConsul(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		registered = make(map[string]*consul.AgentServiceRegistration)
+	)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1/agent/service/register":
+			var reg consul.AgentServiceRegistration
+			json.NewDecoder(r.Body).Decode(&reg)
+			registered[reg.ID] = &reg
+		case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+			delete(registered, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+		}
+	}))
+	defer agent.Close()
+	client, err := registry.NewClient(agent.URL)
+	require.NoError(t, err)
+
+	consulRegister := registry.NewConsulRegister(client, "test", 0, nil)
+	consulRegister.Address = "10.1.2.3"
+	consulRegister.TTL = time.Minute
+	s := server.NewGRPCServer(log.NewFactory(zap.NewNop()), "test").
+		WithConsul(consulRegister).
+		WithHandler(func(*grpc.Server) {})
+	require.Equal(t, log.Factory{}, consulRegister.Logger, "the caller's registration is left unchanged")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, s.Serve(ln))
+
+	// named after the advertised address
+	id := fmt.Sprintf("test-10.1.2.3-%d", ln.Addr().(*net.TCPAddr).Port)
+	require.Equal(t, id, s.GetConsulID())
+	mu.Lock()
+	reg := registered[id]
+	mu.Unlock()
+	require.NotNil(t, reg)
+	require.Equal(t, "10.1.2.3", reg.Address)
+	require.Equal(t, "1m0s", reg.Check.TTL)
+
+	require.NoError(t, s.Stop(context.Background()))
+	mu.Lock()
+	defer mu.Unlock()
+	require.Empty(t, registered)
+}
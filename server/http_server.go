@@ -1,5 +1,291 @@
 package server
 
-// HTTPServer ...
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	"github.com/richard-xtek/go-grpc-micro-kit/grpcmapping"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/recoveryhandler"
+)
+
+// GatewayRegister registers grpc-gateway handlers on mux. Its signature
+// matches the generated RegisterXXXHandlerFromEndpoint functions.
+type GatewayRegister func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error
+
+// HTTPMiddleware wraps the gateway handler.
+type HTTPMiddleware func(http.Handler) http.Handler
+
+// NewHTTPServer ...
+func NewHTTPServer(logger log.Factory, name string) *HTTPServer {
+	s := &HTTPServer{logger: logger}
+	s.name = name
+	s.shutdownTimeout = DefaultShutdownTimeout
+
+	return s
+}
+
+// HTTPServer hosts grpc-gateway handlers that proxy REST calls to a gRPC endpoint.
 type HTTPServer struct {
+	name string
+	host string
+	port string
+
+	logger log.Factory
+	server *http.Server
+	mux    *runtime.ServeMux
+
+	mu         sync.Mutex
+	didStarted bool
+	cancel     context.CancelFunc
+
+	shutdownTimeout time.Duration
+
+	grpcEndpoint    string
+	gatewayRegister []GatewayRegister
+	muxOptions      []runtime.ServeMuxOption
+	dialOptions     []grpc.DialOption
+	dialCreds       credentials.TransportCredentials
+	middlewares     []HTTPMiddleware
+	httpHandlers    map[string]http.Handler
+
+	tracer opentracing.Tracer
+
+	// h2c serves HTTP/2 without TLS, used when sharing a port with gRPC
+	h2c bool
+}
+
+// WithPort ...
+func (s *HTTPServer) WithPort(port string) *HTTPServer {
+	s.port = port
+	return s
+}
+
+// WithHost ...
+func (s *HTTPServer) WithHost(host string) *HTTPServer {
+	s.host = host
+	return s
+}
+
+// WithTracer ...
+func (s *HTTPServer) WithTracer(tracer opentracing.Tracer) *HTTPServer {
+	s.tracer = tracer
+	return s
+}
+
+// WithGRPCEndpoint sets the address of the gRPC server the gateway proxies to.
+func (s *HTTPServer) WithGRPCEndpoint(endpoint string) *HTTPServer {
+	s.grpcEndpoint = endpoint
+	return s
+}
+
+// WithHandler adds a callback registering gateway handlers on the mux.
+func (s *HTTPServer) WithHandler(handler GatewayRegister) *HTTPServer {
+	s.gatewayRegister = append(s.gatewayRegister, handler)
+	return s
+}
+
+// WithServeMuxOption adds options to the runtime.ServeMux. They are applied
+// after the defaults, so they can override them.
+func (s *HTTPServer) WithServeMuxOption(opts ...runtime.ServeMuxOption) *HTTPServer {
+	s.muxOptions = append(s.muxOptions, opts...)
+	return s
+}
+
+// WithDialOption adds options used by the gateway to dial the gRPC endpoint.
+func (s *HTTPServer) WithDialOption(opts ...grpc.DialOption) *HTTPServer {
+	s.dialOptions = append(s.dialOptions, opts...)
+	return s
+}
+
+// WithDialCredentials sets the transport credentials used by the gateway to
+// dial the gRPC endpoint. Without them the gateway dials insecurely.
+func (s *HTTPServer) WithDialCredentials(creds credentials.TransportCredentials) *HTTPServer {
+	s.dialCreds = creds
+	return s
+}
+
+// WithMiddleware wraps the gateway handler. Middlewares run in the order they are added,
+// inside the recovery and CORS handlers.
+func (s *HTTPServer) WithMiddleware(middleware HTTPMiddleware) *HTTPServer {
+	s.middlewares = append(s.middlewares, middleware)
+	return s
+}
+
+// WithHTTPHandler serves a plain HTTP handler, e.g. promhttp.Handler(), next
+// to the gateway. Patterns follow http.ServeMux; the gateway serves "/".
+func (s *HTTPServer) WithHTTPHandler(pattern string, handler http.Handler) *HTTPServer {
+	if s.httpHandlers == nil {
+		s.httpHandlers = make(map[string]http.Handler)
+	}
+	s.httpHandlers[pattern] = handler
+	return s
+}
+
+// WithShutdownTimeout sets how long Stop waits for in-flight requests when
+// the context passed to Stop has no deadline.
+func (s *HTTPServer) WithShutdownTimeout(timeout time.Duration) *HTTPServer {
+	s.shutdownTimeout = timeout
+	return s
+}
+
+// GetAddressListen ...
+func (s *HTTPServer) GetAddressListen() string {
+	return fmt.Sprintf("%s:%s", s.host, s.port)
+}
+
+// GetServeMux ...
+func (s *HTTPServer) GetServeMux() *runtime.ServeMux {
+	return s.mux
+}
+
+func (s *HTTPServer) makeServer(ctx context.Context) (http.Handler, error) {
+	muxOpts := []runtime.ServeMuxOption{
+		runtime.WithProtoErrorHandler(grpcmapping.TransformErrors),
+		runtime.WithForwardResponseOption(grpcmapping.FormatHTTPResponse),
+		runtime.WithMetadata(grpcmapping.AppendRequestMetadata),
+		runtime.WithIncomingHeaderMatcher(grpcmapping.IncomingHeaderMatcher),
+	}
+	s.mux = runtime.NewServeMux(append(muxOpts, s.muxOptions...)...)
+
+	dialOpts := []grpc.DialOption{grpc.WithInsecure()}
+	if s.dialCreds != nil {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(s.dialCreds)}
+	}
+	if s.tracer != nil {
+		dialOpts = append(dialOpts,
+			grpc.WithUnaryInterceptor(grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(s.tracer))),
+			grpc.WithStreamInterceptor(grpc_opentracing.StreamClientInterceptor(grpc_opentracing.WithTracer(s.tracer))),
+		)
+	}
+	dialOpts = append(dialOpts, s.dialOptions...)
+
+	for _, register := range s.gatewayRegister {
+		if err := register(ctx, s.mux, s.grpcEndpoint, dialOpts); err != nil {
+			return nil, err
+		}
+	}
+
+	var handler http.Handler = s.mux
+	if len(s.httpHandlers) > 0 {
+		mux := http.NewServeMux()
+		for pattern, h := range s.httpHandlers {
+			mux.Handle(pattern, h)
+		}
+		if _, ok := s.httpHandlers["/"]; !ok {
+			mux.Handle("/", s.mux)
+		}
+		handler = mux
+	}
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		handler = s.middlewares[i](handler)
+	}
+	if s.tracer != nil {
+		handler = s.tracingHandler(handler)
+	}
+	handler = grpcmapping.HandleCrossOrigin(handler)
+	handler = recoveryhandler.NewLogRecoveryHandler(s.logger.Bg(), true)(handler)
+	if s.h2c {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	return handler, nil
+}
+
+// tracingHandler starts a server span for every request, continuing the
+// trace propagated in the HTTP headers if any.
+func (s *HTTPServer) tracingHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spanCtx, _ := s.tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+		span := s.tracer.StartSpan("HTTP "+r.Method+" "+r.URL.Path, ext.RPCServerOption(spanCtx))
+		defer span.Finish()
+
+		ext.HTTPMethod.Set(span, r.Method)
+		ext.HTTPUrl.Set(span, r.URL.String())
+
+		h.ServeHTTP(w, r.WithContext(opentracing.ContextWithSpan(r.Context(), span)))
+	})
+}
+
+// Start ...
+func (s *HTTPServer) Start() error {
+	ln, err := net.Listen("tcp", s.GetAddressListen())
+	if err != nil {
+		return err
+	}
+	return s.serveWithListener(ln)
+}
+
+func (s *HTTPServer) serveWithListener(l net.Listener) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.didStarted {
+		l.Close()
+		return fmt.Errorf("%s HTTP Server already started", s.name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler, err := s.makeServer(ctx)
+	if err != nil {
+		cancel()
+		l.Close()
+		return err
+	}
+	s.cancel = cancel
+	s.server = &http.Server{Handler: handler}
+
+	s.logger.Bg().Info("Starting " + s.name + " HTTP Server on " + l.Addr().String())
+	go func() {
+		if err := s.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			s.logger.Bg().Error("Serve "+s.name+" HTTP Server", zap.Error(err))
+		}
+	}()
+	s.didStarted = true
+
+	return nil
+}
+
+// Stop gracefully shuts the server down, waiting for in-flight requests
+// until ctx expires, then closes the connections to the gRPC endpoint.
+func (s *HTTPServer) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.didStarted {
+		return nil
+	}
+	s.didStarted = false
+
+	if _, ok := ctx.Deadline(); !ok && s.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+	}
+
+	s.logger.Bg().Info("Stopping " + s.name + " HTTP Server")
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.logger.Bg().Warn("Force stopping "+s.name+" HTTP Server", zap.Error(err))
+		s.server.Close()
+	}
+
+	// closes the gateway connections dialed from endpoint
+	s.cancel()
+
+	return err
 }
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func TestHTTPServer(t *testing.T) {
+	logger := log.NewFactory(zap.NewNop())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := NewGRPCServer(logger, "test").WithHandler(func(*grpc.Server) {})
+	require.NoError(t, grpcServer.Serve(grpcListener))
+	defer grpcServer.Stop(ctx)
+
+	httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewHTTPServer(logger, "test").
+		WithGRPCEndpoint(grpcListener.Addr().String()).
+		WithHandler(registerHealthGateway).
+		WithHTTPHandler("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("pong"))
+		}))
+	require.NoError(t, s.serveWithListener(httpListener))
+	url := "http://" + httpListener.Addr().String()
+
+	get := func(t *testing.T, path string) string {
+		resp, err := http.Get(url + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("Gateway", func(t *testing.T) {
+		require.Equal(t, "SERVING", get(t, "/health"))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		// NotFound from the gRPC server is rendered by TransformErrors
+		var body struct {
+			Error struct {
+				Code   int32  `json:"code"`
+				Domain string `json:"domain"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(get(t, "/health?service=unknown")), &body))
+		require.Equal(t, int32(-1), body.Error.Code)
+		require.Equal(t, "zpi", body.Error.Domain)
+	})
+
+	t.Run("HTTPHandler", func(t *testing.T) {
+		require.Equal(t, "pong", get(t, "/ping"))
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		require.NoError(t, s.Stop(ctx))
+		_, err := http.Get(url + "/ping")
+		require.Error(t, err)
+		require.NoError(t, s.Stop(ctx), "already stopped")
+	})
+}
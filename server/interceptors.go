@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_logging "github.com/grpc-ecosystem/go-grpc-middleware/logging"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/richard-xtek/go-grpc-micro-kit/auth/requestinfo"
+	grpc_logf "github.com/richard-xtek/go-grpc-micro-kit/grpc-logf"
+	"github.com/richard-xtek/go-grpc-micro-kit/tlsconfig"
+	"github.com/richard-xtek/go-grpc-micro-kit/utils/validator"
+	"google.golang.org/grpc"
+)
+
+// Names of the interceptor slots of the default chain, in their default order.
+const (
+	// InterceptorIdentity puts the verified TLS client identity in the context.
+	InterceptorIdentity = "identity"
+	// InterceptorRequestInfo builds requestinfo.RequestInfo from metadata (unary only).
+	InterceptorRequestInfo = "requestinfo"
+	// InterceptorRateLimit is empty by default; replace it with the ratelimit
+	// interceptors so rejected calls stop before the rest of the chain.
+	InterceptorRateLimit = "ratelimit"
+	// InterceptorCtxTags ...
+	InterceptorCtxTags = "ctxtags"
+	// InterceptorTracing ...
+	InterceptorTracing = "tracing"
+	// InterceptorPrometheus ...
+	InterceptorPrometheus = "prometheus"
+	// InterceptorLogging ...
+	InterceptorLogging = "logging"
+	// InterceptorPayloadLogging ...
+	InterceptorPayloadLogging = "payload_logging"
+	// InterceptorRecovery ...
+	InterceptorRecovery = "recovery"
+	// InterceptorValidation rejects invalid requests with codes.InvalidArgument,
+	// see validator.ValidateRequest.
+	InterceptorValidation = "validation"
+)
+
+// interceptorSlot is a named position in the interceptor chain. A slot may
+// hold a unary interceptor, a stream interceptor or both.
+type interceptorSlot struct {
+	name   string
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+}
+
+// interceptorConfig records how the default chain is customized.
+type interceptorConfig struct {
+	disabled map[string]bool
+	replaced []interceptorSlot
+	order    []string
+
+	unaryPrepend  []grpc.UnaryServerInterceptor
+	streamPrepend []grpc.StreamServerInterceptor
+
+	payloadDecider grpc_logging.ServerPayloadLoggingDecider
+}
+
+// DisableInterceptor removes the named slots from both the unary and the
+// stream chain.
+func (s *GRPCServer) DisableInterceptor(names ...string) *GRPCServer {
+	if s.interceptors.disabled == nil {
+		s.interceptors.disabled = make(map[string]bool)
+	}
+	for _, name := range names {
+		s.interceptors.disabled[name] = true
+	}
+	return s
+}
+
+// ReplaceUnaryServerInterceptor replaces the unary interceptor of the named
+// slot. An unknown name adds a new slot after the default ones.
+func (s *GRPCServer) ReplaceUnaryServerInterceptor(name string, usi grpc.UnaryServerInterceptor) *GRPCServer {
+	s.interceptors.replaced = append(s.interceptors.replaced, interceptorSlot{name: name, unary: usi})
+	return s
+}
+
+// ReplaceStreamServerInterceptor replaces the stream interceptor of the named
+// slot. An unknown name adds a new slot after the default ones.
+func (s *GRPCServer) ReplaceStreamServerInterceptor(name string, ssi grpc.StreamServerInterceptor) *GRPCServer {
+	s.interceptors.replaced = append(s.interceptors.replaced, interceptorSlot{name: name, stream: ssi})
+	return s
+}
+
+// WithInterceptorOrder moves the named slots to the front of the chain in the
+// given order. The other slots follow in their default order.
+func (s *GRPCServer) WithInterceptorOrder(names ...string) *GRPCServer {
+	s.interceptors.order = names
+	return s
+}
+
+// PrependUnaryServerInterceptor runs usi before the default chain.
+func (s *GRPCServer) PrependUnaryServerInterceptor(usi grpc.UnaryServerInterceptor) *GRPCServer {
+	s.interceptors.unaryPrepend = append(s.interceptors.unaryPrepend, usi)
+	return s
+}
+
+// PrependStreamServerInterceptor runs ssi before the default chain.
+func (s *GRPCServer) PrependStreamServerInterceptor(ssi grpc.StreamServerInterceptor) *GRPCServer {
+	s.interceptors.streamPrepend = append(s.interceptors.streamPrepend, ssi)
+	return s
+}
+
+// WithPayloadLoggingDecider decides which calls get their payload logged.
+// By default every payload is logged.
+func (s *GRPCServer) WithPayloadLoggingDecider(decider grpc_logging.ServerPayloadLoggingDecider) *GRPCServer {
+	s.interceptors.payloadDecider = decider
+	return s
+}
+
+func (s *GRPCServer) defaultInterceptorSlots() []interceptorSlot {
+	payloadDecider := s.interceptors.payloadDecider
+	if payloadDecider == nil {
+		payloadDecider = func(ctx context.Context, fullMethodName string, servingObject interface{}) bool { return true }
+	}
+	tracingFilter := grpc_opentracing.WithFilterFunc(func(ctx context.Context, fullMethodName string) bool {
+		if fullMethodName == "/grpc.health.v1.Health/Check" || fullMethodName == "/grpc.health.v1.Health/Watch" {
+			return false
+		}
+		return true
+	})
+
+	return []interceptorSlot{{
+		name:   InterceptorIdentity,
+		unary:  tlsconfig.UnaryServerInterceptor(),
+		stream: tlsconfig.StreamServerInterceptor(),
+	}, {
+		name:  InterceptorRequestInfo,
+		unary: requestinfo.UnaryServerAuth(requestinfo.Authentication(s.logger)),
+	}, {
+		name: InterceptorRateLimit,
+	}, {
+		name:   InterceptorCtxTags,
+		unary:  grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+		stream: grpc_ctxtags.StreamServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+	}, {
+		name:   InterceptorTracing,
+		unary:  grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(s.tracer), tracingFilter),
+		stream: grpc_opentracing.StreamServerInterceptor(grpc_opentracing.WithTracer(s.tracer)),
+	}, {
+		name:   InterceptorPrometheus,
+		unary:  grpc_prometheus.UnaryServerInterceptor,
+		stream: grpc_prometheus.StreamServerInterceptor,
+	}, {
+		name:   InterceptorLogging,
+		unary:  grpc_logf.UnaryServerInterceptor(s.logger),
+		stream: grpc_logf.StreamServerInterceptor(s.logger),
+	}, {
+		name:   InterceptorPayloadLogging,
+		unary:  grpc_logf.PayloadUnaryServerInterceptor(s.logger, payloadDecider),
+		stream: grpc_logf.PayloadStreamServerInterceptor(s.logger, payloadDecider),
+	}, {
+		name:   InterceptorRecovery,
+		unary:  grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(s.recoveryHandler)),
+		stream: grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(s.recoveryHandler)),
+	}, {
+		name:   InterceptorValidation,
+		unary:  validator.UnaryServerInterceptor(),
+		stream: validator.StreamServerInterceptor(),
+	}}
+}
+
+// interceptorSlots returns the default slots with the replacements, the
+// order and the disabled slots applied.
+func (s *GRPCServer) interceptorSlots() []interceptorSlot {
+	slots := s.defaultInterceptorSlots()
+
+	for _, r := range s.interceptors.replaced {
+		found := false
+		for i := range slots {
+			if slots[i].name != r.name {
+				continue
+			}
+			found = true
+			if r.unary != nil {
+				slots[i].unary = r.unary
+			}
+			if r.stream != nil {
+				slots[i].stream = r.stream
+			}
+		}
+		if !found {
+			slots = append(slots, r)
+		}
+	}
+
+	ordered := make([]interceptorSlot, 0, len(slots))
+	used := make(map[string]bool)
+	for _, name := range s.interceptors.order {
+		for _, slot := range slots {
+			if slot.name == name && !used[name] {
+				ordered = append(ordered, slot)
+				used[name] = true
+			}
+		}
+	}
+	for _, slot := range slots {
+		if !used[slot.name] {
+			ordered = append(ordered, slot)
+		}
+	}
+
+	enabled := ordered[:0]
+	for _, slot := range ordered {
+		if !s.interceptors.disabled[slot.name] {
+			enabled = append(enabled, slot)
+		}
+	}
+	return enabled
+}
+
+func (s *GRPCServer) unaryInterceptorChain() grpc.UnaryServerInterceptor {
+	chain := append([]grpc.UnaryServerInterceptor{}, s.interceptors.unaryPrepend...)
+	for _, slot := range s.interceptorSlots() {
+		if slot.unary != nil {
+			chain = append(chain, slot.unary)
+		}
+	}
+	chain = append(chain, s.grpcUnaryInterceptors...)
+
+	return grpc_middleware.ChainUnaryServer(chain...)
+}
+
+func (s *GRPCServer) streamInterceptorChain() grpc.StreamServerInterceptor {
+	chain := append([]grpc.StreamServerInterceptor{}, s.interceptors.streamPrepend...)
+	for _, slot := range s.interceptorSlots() {
+		if slot.stream != nil {
+			chain = append(chain, slot.stream)
+		}
+	}
+	chain = append(chain, s.grpcStreamInterceptors...)
+
+	return grpc_middleware.ChainStreamServer(chain...)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func slotNames(slots []interceptorSlot) []string {
+	var names []string
+	for _, slot := range slots {
+		names = append(names, slot.name)
+	}
+	return names
+}
+
+func TestGRPCServer_interceptorSlots(t *testing.T) {
+	newServer := func() *GRPCServer {
+		return NewGRPCServer(log.NewFactory(zap.NewNop()), "test")
+	}
+	noop := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(ctx, req)
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		require.Equal(t, []string{
+			InterceptorIdentity, InterceptorRequestInfo, InterceptorRateLimit, InterceptorCtxTags,
+			InterceptorTracing, InterceptorPrometheus, InterceptorLogging, InterceptorPayloadLogging,
+			InterceptorRecovery, InterceptorValidation,
+		}, slotNames(newServer().interceptorSlots()))
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		s := newServer().DisableInterceptor(InterceptorRequestInfo, InterceptorPayloadLogging)
+		require.Equal(t, []string{
+			InterceptorIdentity, InterceptorRateLimit, InterceptorCtxTags, InterceptorTracing,
+			InterceptorPrometheus, InterceptorLogging, InterceptorRecovery, InterceptorValidation,
+		}, slotNames(s.interceptorSlots()))
+	})
+
+	t.Run("Reorder", func(t *testing.T) {
+		s := newServer().WithInterceptorOrder(InterceptorRecovery, InterceptorLogging)
+		require.Equal(t, []string{
+			InterceptorRecovery, InterceptorLogging, InterceptorIdentity, InterceptorRequestInfo,
+			InterceptorRateLimit, InterceptorCtxTags, InterceptorTracing, InterceptorPrometheus, InterceptorPayloadLogging,
+			InterceptorValidation,
+		}, slotNames(s.interceptorSlots()))
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		s := newServer().
+			ReplaceUnaryServerInterceptor(InterceptorRequestInfo, noop).
+			ReplaceUnaryServerInterceptor("auth", noop)
+		slots := s.interceptorSlots()
+		require.Equal(t, InterceptorRequestInfo, slots[1].name)
+		require.Nil(t, slots[1].stream)
+		require.Equal(t, "auth", slots[len(slots)-1].name)
+	})
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	// sniffTimeout bounds how long a new connection may take to complete its
+	// TLS handshake or send enough bytes to be classified as gRPC or HTTP.
+	sniffTimeout = 10 * time.Second
+)
+
+var errListenerClosed = errors.New("mux: listener closed")
+
+// listenerMux accepts connections on a single listener and hands them to a
+// gRPC or an HTTP sub listener. An HTTP/2 connection, negotiated through ALPN
+// or starting with the client preface, is gRPC when its first request has the
+// application/grpc content type. Everything else, HTTP/1.x included, goes to
+// the HTTP listener.
+//
+// gRPC clients wait for the server SETTINGS before sending any request, so
+// the mux sends an empty SETTINGS frame to the HTTP/2 connections, like
+// cmux's HTTP2MatchHeaderFieldSendSettings, and drops the client ACK of it
+// before the server reads it.
+type listenerMux struct {
+	root net.Listener
+
+	grpc *muxListener
+	http *muxListener
+
+	wg sync.WaitGroup
+}
+
+func newListenerMux(root net.Listener) *listenerMux {
+	return &listenerMux{
+		root: root,
+		grpc: newMuxListener(root),
+		http: newMuxListener(root),
+	}
+}
+
+// serve dispatches connections until the root listener is closed.
+func (m *listenerMux) serve() error {
+	defer func() {
+		m.wg.Wait()
+		m.grpc.Close()
+		m.http.Close()
+	}()
+
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		m.wg.Add(1)
+		go m.dispatch(conn)
+	}
+}
+
+func (m *listenerMux) dispatch(conn net.Conn) {
+	defer m.wg.Done()
+
+	conn.SetDeadline(time.Now().Add(sniffTimeout))
+	conn, isGRPC, err := classify(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	target := m.http
+	if isGRPC {
+		target = m.grpc
+	}
+	if !target.push(conn) {
+		conn.Close()
+	}
+}
+
+// Close stops accepting connections on the root listener.
+func (m *listenerMux) Close() error {
+	return m.root.Close()
+}
+
+// classify tells whether conn is a gRPC connection. The returned connection
+// replays the bytes read while classifying and must be used instead of conn.
+func classify(conn net.Conn) (net.Conn, bool, error) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return conn, false, err
+		}
+		if tc.ConnectionState().NegotiatedProtocol == "http/1.1" {
+			return conn, false, nil
+		}
+	}
+
+	sc := &sniffConn{Conn: conn}
+	r := io.TeeReader(conn, &sc.buf)
+	isHTTP2, err := sniffPreface(r)
+	if err != nil || !isHTTP2 {
+		return sc, false, err
+	}
+
+	sc.dropAck = true
+	if err := http2.NewFramer(conn, nil).WriteSettings(); err != nil {
+		return sc, false, err
+	}
+	isGRPC, err := sniffContentType(r)
+	return sc, isGRPC, err
+}
+
+// sniffPreface reads from r until it can tell whether it starts with the
+// HTTP/2 client preface. It stops as soon as the bytes read diverge from it,
+// so HTTP/1.x requests shorter than the preface are classified right away.
+func sniffPreface(r io.Reader) (bool, error) {
+	preface := []byte(http2.ClientPreface)
+	buf := make([]byte, len(preface))
+	for n := 0; n < len(buf); {
+		k, err := r.Read(buf[n:])
+		n += k
+		if !bytes.Equal(buf[:n], preface[:n]) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// sniffContentType reads the HTTP/2 frames from r, past the client preface,
+// until the headers of the first request and tells whether its content type
+// is gRPC.
+func sniffContentType(r io.Reader) (bool, error) {
+	framer := http2.NewFramer(ioutil.Discard, r)
+	decoder := hpack.NewDecoder(4096, nil)
+	var isGRPC bool
+	decoder.SetEmitFunc(func(f hpack.HeaderField) {
+		if f.Name == "content-type" {
+			isGRPC = strings.HasPrefix(f.Value, "application/grpc")
+		}
+	})
+
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			return false, err
+		}
+		var fragment []byte
+		switch f := f.(type) {
+		case *http2.HeadersFrame:
+			fragment = f.HeaderBlockFragment()
+		case *http2.ContinuationFrame:
+			fragment = f.HeaderBlockFragment()
+		default:
+			continue
+		}
+		if _, err := decoder.Write(fragment); err != nil {
+			return false, err
+		}
+		if f.Header().Flags.Has(http2.FlagHeadersEndHeaders) {
+			return isGRPC, decoder.Close()
+		}
+	}
+}
+
+// sniffConn replays the bytes read while sniffing before reading from the
+// underlying connection again. When the mux sent its own SETTINGS frame, it
+// drops the first SETTINGS ACK of the client, which the server would reject
+// as the ACK of settings it never sent.
+type sniffConn struct {
+	net.Conn
+
+	buf bytes.Buffer
+
+	dropAck bool
+	// prefaced is set once the client preface is read
+	prefaced bool
+	// frame is the rest of the frame being read
+	frame []byte
+}
+
+// ConnectionState returns the TLS state when the listener terminates TLS.
+func (c *sniffConn) ConnectionState() tls.ConnectionState {
+	if tc, ok := c.Conn.(*tls.Conn); ok {
+		return tc.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
+
+func (c *sniffConn) Read(p []byte) (int, error) {
+	if !c.dropAck {
+		return c.read(p)
+	}
+
+	for len(c.frame) == 0 {
+		if !c.prefaced {
+			c.frame = make([]byte, len(http2.ClientPreface))
+			if _, err := io.ReadFull(readerFunc(c.read), c.frame); err != nil {
+				return 0, err
+			}
+			c.prefaced = true
+			break
+		}
+
+		header := make([]byte, 9)
+		if _, err := io.ReadFull(readerFunc(c.read), header); err != nil {
+			return 0, err
+		}
+		length := int(binary.BigEndian.Uint32(header[:4]) >> 8)
+		if http2.FrameType(header[3]) == http2.FrameSettings && http2.Flags(header[4]).Has(http2.FlagSettingsAck) && length == 0 {
+			// the ACK of the mux SETTINGS, the following frames go through
+			c.dropAck = false
+			return c.read(p)
+		}
+		c.frame = make([]byte, len(header)+length)
+		copy(c.frame, header)
+		if _, err := io.ReadFull(readerFunc(c.read), c.frame[len(header):]); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.frame)
+	c.frame = c.frame[n:]
+	return n, nil
+}
+
+// read reads the replayed bytes, then the underlying connection.
+func (c *sniffConn) read(p []byte) (int, error) {
+	if c.buf.Len() > 0 {
+		return c.buf.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// muxListener is a net.Listener fed by a listenerMux.
+type muxListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newMuxListener(root net.Listener) *muxListener {
+	return &muxListener{
+		addr:  root.Addr(),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *muxListener) push(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// Accept ...
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+// Close only closes the sub listener; the root listener keeps accepting.
+func (l *muxListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// Addr ...
+func (l *muxListener) Addr() net.Addr {
+	return l.addr
+}
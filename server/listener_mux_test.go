@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// registerHealthGateway serves GET /health?service= on the gateway by
+// calling the gRPC health service of endpoint.
+func registerHealthGateway(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error {
+	conn, err := grpc.DialContext(ctx, endpoint, opts...)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	client := healthpb.NewHealthClient(conn)
+	pattern := runtime.MustPattern(runtime.NewPattern(1, []int{int(utilities.OpLitPush), 0}, []string{"health"}, ""))
+	mux.Handle(http.MethodGet, pattern, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		resp, err := client.Check(r.Context(), &healthpb.HealthCheckRequest{Service: r.URL.Query().Get("service")})
+		if err != nil {
+			_, outbound := runtime.MarshalerForRequest(mux, r)
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+		fmt.Fprint(w, resp.Status.String())
+	})
+	return nil
+}
+
+func startSharedServer(t *testing.T) string {
+	logger := log.NewFactory(zap.NewNop())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+
+	// the gateway dials the listener served, not the configured port
+	httpServer := NewHTTPServer(logger, "test").
+		WithHandler(registerHealthGateway)
+	s := NewGRPCServer(logger, "test").
+		WithPort("1").
+		WithHandler(func(*grpc.Server) {}).
+		WithHTTPServer(httpServer)
+	require.NoError(t, s.Serve(ln))
+	require.Equal(t, addr, s.GetDialAddress())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, s.Stop(ctx))
+	})
+
+	return addr
+}
+
+func TestListenerMux(t *testing.T) {
+	addr := startSharedServer(t)
+
+	t.Run("GRPC", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	t.Run("HTTP1", func(t *testing.T) {
+		resp, err := http.Get("http://" + addr + "/health")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 1, resp.ProtoMajor)
+		require.Equal(t, "SERVING", string(body))
+	})
+
+	t.Run("H2C", func(t *testing.T) {
+		// HTTP/2 with prior knowledge is routed by content type
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+		defer client.CloseIdleConnections()
+
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get("http://" + addr + "/health")
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, 2, resp.ProtoMajor)
+			require.Equal(t, "SERVING", string(body))
+		}
+	})
+
+	t.Run("ShortHTTP1", func(t *testing.T) {
+		// shorter than the HTTP/2 client preface
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+		_, err = conn.Write([]byte("GET /health HTTP/1.0\r\n\r\n"))
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("H2CUpgrade", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		_, err = conn.Write([]byte("GET /health HTTP/1.1\r\n" +
+			"Host: " + addr + "\r\n" +
+			"Connection: Upgrade, HTTP2-Settings\r\n" +
+			"Upgrade: h2c\r\n" +
+			"HTTP2-Settings: \r\n\r\n"))
+		require.NoError(t, err)
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		_, err = conn.Write([]byte(http2.ClientPreface))
+		require.NoError(t, err)
+		framer := http2.NewFramer(conn, br)
+		require.NoError(t, framer.WriteSettings())
+
+		// the upgraded request is answered on stream 1
+		var status string
+		var body strings.Builder
+		decoder := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+			if f.Name == ":status" {
+				status = f.Value
+			}
+		})
+		for {
+			f, err := framer.ReadFrame()
+			require.NoError(t, err)
+			if f.Header().StreamID != 1 {
+				continue
+			}
+			switch f := f.(type) {
+			case *http2.HeadersFrame:
+				_, err := decoder.Write(f.HeaderBlockFragment())
+				require.NoError(t, err)
+			case *http2.DataFrame:
+				body.Write(f.Data())
+			}
+			if f.Header().Flags.Has(http2.FlagDataEndStream) {
+				break
+			}
+		}
+		require.Equal(t, "200", status)
+		require.Equal(t, "SERVING", body.String())
+	})
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	grpc_logf "github.com/richard-xtek/go-grpc-micro-kit/grpc-logf"
+	"github.com/richard-xtek/go-grpc-micro-kit/grpcmapping"
+	"github.com/richard-xtek/go-grpc-micro-kit/tracing"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var panicsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_server_panics_recovered_total",
+	Help: "Total number of panics recovered in gRPC handlers.",
+}, []string{"grpc_service", "grpc_method"})
+
+// recoveryHandler turns a panic into a codes.Internal status carrying an
+// errors.Error detail, logs the stack trace and counts the panic.
+func (s *GRPCServer) recoveryHandler(ctx context.Context, p interface{}) error {
+	fullMethod, _ := grpc.Method(ctx)
+	service, method := path.Dir(fullMethod), path.Base(fullMethod)
+	if len(service) > 0 && service[0] == '/' {
+		service = service[1:]
+	}
+	panicsTotal.WithLabelValues(service, method).Inc()
+
+	logger := grpc_logf.Extract(ctx)
+	logger.For(ctx).Error("Recovery catched",
+		zap.String("p", fmt.Sprintf("%v", p)),
+		zap.String("grpc.method", fullMethod),
+		zap.ByteString("stacktrace", debug.Stack()),
+	)
+	tracing.WriteLogGRPCMessage(ctx, true)
+
+	detail := grpcmapping.NewErrorDetail(grpcmapping.CodeException)
+	st, err := status.New(codes.Internal, detail.Message).WithDetails(detail)
+	if err != nil {
+		return status.Error(codes.Internal, detail.Message)
+	}
+	return st.Err()
+}
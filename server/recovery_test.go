@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/richard-xtek/go-grpc-micro-kit/grpc-gen/errors"
+	"github.com/richard-xtek/go-grpc-micro-kit/grpcmapping"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecoveryHandler(t *testing.T) {
+	s := NewGRPCServer(log.NewFactory(zap.NewNop()), "test")
+
+	err := s.recoveryHandler(context.Background(), "boom")
+
+	st, _ := status.FromError(err)
+	require.Equal(t, codes.Internal, st.Code())
+	require.Len(t, st.Details(), 1)
+	detail, ok := st.Details()[0].(*errors.Error)
+	require.True(t, ok, "detail is %T, want *errors.Error", st.Details()[0])
+	require.Equal(t, int32(grpcmapping.CodeException), detail.Code)
+	require.NotEmpty(t, detail.Domain)
+}
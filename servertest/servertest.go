@@ -0,0 +1,123 @@
+// Package servertest runs a server.GRPCServer in process for tests. The
+// server listens on an in-memory bufconn listener with the default
+// interceptor chain, and the client connection goes through the dialer's
+// client interceptors. Logs are recorded by a zap observer and spans by a
+// mock tracer so tests can assert on both.
+package servertest
+
+import (
+	"context"
+	"net"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	dialer "github.com/richard-xtek/go-grpc-micro-kit/grpc-dialer"
+	"github.com/richard-xtek/go-grpc-micro-kit/log"
+	"github.com/richard-xtek/go-grpc-micro-kit/server"
+)
+
+const bufSize = 1024 * 1024
+
+// NewServer returns a test server registering its services with register.
+// Customize it through GRPCServer before calling Start.
+func NewServer(register server.GRPCRegister) *Server {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := log.NewFactory(zap.New(core))
+	tracer := mocktracer.New()
+
+	s := &Server{
+		logger: logger,
+		logs:   logs,
+		tracer: tracer,
+	}
+	s.grpcServer = server.NewGRPCServer(logger, "servertest").
+		WithTracer(tracer).
+		WithHandler(register)
+
+	return s
+}
+
+// Server is a GRPCServer served on a bufconn listener.
+type Server struct {
+	logger log.Factory
+	logs   *observer.ObservedLogs
+	tracer *mocktracer.MockTracer
+
+	grpcServer  *server.GRPCServer
+	listener    *bufconn.Listener
+	conn        *grpc.ClientConn
+	dialOptions []grpc.DialOption
+}
+
+// WithDialOption adds options used to dial the client connection, e.g.
+// extra client interceptors.
+func (s *Server) WithDialOption(opts ...grpc.DialOption) *Server {
+	s.dialOptions = append(s.dialOptions, opts...)
+	return s
+}
+
+// GRPCServer returns the server under test.
+func (s *Server) GRPCServer() *server.GRPCServer {
+	return s.grpcServer
+}
+
+// Logger returns the observer backed log factory shared by server and client.
+func (s *Server) Logger() log.Factory {
+	return s.logger
+}
+
+// Logs returns the logs written so far by server and client.
+func (s *Server) Logs() *observer.ObservedLogs {
+	return s.logs
+}
+
+// Tracer returns the tracer shared by server and client. Finished spans are
+// available through Tracer().FinishedSpans().
+func (s *Server) Tracer() *mocktracer.MockTracer {
+	return s.tracer
+}
+
+// Conn returns the client connection to the server, nil before Start.
+func (s *Server) Conn() *grpc.ClientConn {
+	return s.conn
+}
+
+// Start serves the server on a bufconn listener and dials it.
+func (s *Server) Start() error {
+	s.listener = bufconn.Listen(bufSize)
+	if err := s.grpcServer.Serve(s.listener); err != nil {
+		return err
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return s.listener.Dial()
+		}),
+	}
+	opts = append(opts, dialer.InterceptorDialOptions(s.tracer, s.logger)...)
+	opts = append(opts, s.dialOptions...)
+
+	conn, err := grpc.Dial("bufconn", opts...)
+	if err != nil {
+		s.grpcServer.Stop(context.Background())
+		return err
+	}
+	s.conn = conn
+
+	return nil
+}
+
+// Close closes the client connection and stops the server.
+func (s *Server) Close() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return s.grpcServer.Stop(context.Background())
+}
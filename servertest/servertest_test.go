@@ -0,0 +1,73 @@
+package servertest
+
+import (
+	"context"
+	"testing"
+
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/richard-xtek/go-grpc-micro-kit/tracing"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type pingService struct {
+	pb_testproto.TestServiceServer
+}
+
+func (pingService) Ping(ctx context.Context, req *pb_testproto.PingRequest) (*pb_testproto.PingResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	value := req.Value
+	if v := md.Get("x-test"); len(v) > 0 {
+		value += " " + v[0]
+	}
+	return &pb_testproto.PingResponse{Value: value}, nil
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(func(server *grpc.Server) {
+		pb_testproto.RegisterTestServiceServer(server, pingService{})
+	})
+	require.NoError(t, s.Start())
+	defer s.Close()
+
+	client := pb_testproto.NewTestServiceClient(s.Conn())
+	root := s.Tracer().StartSpan("test")
+	ctx := opentracing.ContextWithSpan(context.Background(), root)
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-test", "metadata")
+	// the logging interceptors only log calls flagged in the trace baggage
+	tracing.WriteLogGRPCMessage(ctx, true)
+
+	resp, err := client.Ping(ctx, &pb_testproto.PingRequest{Value: "ping"})
+	require.NoError(t, err)
+	require.Equal(t, "ping metadata", resp.Value)
+
+	_, err = client.PingEmpty(ctx, &pb_testproto.Empty{})
+	require.Equal(t, codes.Internal, status.Code(err), "the panic of the nil embedded server is recovered")
+
+	logs := s.Logs().FilterField(zap.String("grpc.method", "Ping"))
+	require.NotZero(t, logs.FilterField(zap.String("span.kind", "server")).Len())
+	require.NotZero(t, logs.FilterField(zap.String("span.kind", "client")).Len())
+
+	var clientSpan, serverSpan *mocktracer.MockSpan
+	for _, span := range s.Tracer().FinishedSpans() {
+		if span.OperationName != "/mwitkow.testproto.TestService/Ping" {
+			continue
+		}
+		if span.Tag(string(ext.SpanKind)) == ext.SpanKindRPCServerEnum {
+			serverSpan = span
+		} else {
+			clientSpan = span
+		}
+	}
+	require.NotNil(t, clientSpan)
+	require.NotNil(t, serverSpan)
+	require.Equal(t, clientSpan.SpanContext.TraceID, serverSpan.SpanContext.TraceID)
+	require.Equal(t, clientSpan.SpanContext.SpanID, serverSpan.ParentID)
+}
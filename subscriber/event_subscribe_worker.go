@@ -1,5 +1,7 @@
 package subscriber
 
+import multierror "github.com/hashicorp/go-multierror"
+
 var (
 	subscriberWorkers *SubscriberWorker
 )
@@ -40,12 +42,13 @@ func (w *SubscriberWorker) Start() error {
 	return nil
 }
 
-// Stop ...
+// Stop stops every subscriber, even when some fail, and returns their errors.
 func (w *SubscriberWorker) Stop() error {
+	var result error
 	for _, subscriber := range w.workerRegistries {
 		if err := subscriber.Stop(); err != nil {
-			return err
+			result = multierror.Append(result, err)
 		}
 	}
-	return nil
+	return result
 }
@@ -0,0 +1,90 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// NewServerCredentials returns gRPC server credentials backed by r.
+func NewServerCredentials(r *Reloader) credentials.TransportCredentials {
+	return credentials.NewTLS(r.ServerConfig("h2"))
+}
+
+// NewClientCredentials returns gRPC client credentials backed by r. The CA
+// bundle is resolved on every handshake so rotated CAs are trusted without
+// redialing.
+func NewClientCredentials(r *Reloader, serverName string) credentials.TransportCredentials {
+	return &clientCredentials{reloader: r, serverName: serverName}
+}
+
+type clientCredentials struct {
+	reloader   *Reloader
+	serverName string
+}
+
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.reloader.ClientConfig(c.serverName)).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *clientCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, credentials.ErrConnDispatched
+}
+
+func (c *clientCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls", SecurityVersion: "1.2", ServerName: c.serverName}
+}
+
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	return &clientCredentials{reloader: c.reloader, serverName: c.serverName}
+}
+
+func (c *clientCredentials) OverrideServerName(serverName string) error {
+	c.serverName = serverName
+	return nil
+}
+
+// connectionStater is implemented by connections that already completed a
+// TLS handshake, e.g. *tls.Conn.
+type connectionStater interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// NewTerminatedCredentials returns gRPC server credentials for connections
+// whose TLS handshake was done by the listener, e.g. when a tls.Listener is
+// shared with an HTTP server. It exposes the connection state as
+// credentials.TLSInfo without handshaking again.
+func NewTerminatedCredentials() credentials.TransportCredentials {
+	return terminatedCredentials{}
+}
+
+type terminatedCredentials struct{}
+
+func (terminatedCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, credentials.ErrConnDispatched
+}
+
+func (terminatedCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	cs, ok := rawConn.(connectionStater)
+	if !ok || !cs.ConnectionState().HandshakeComplete {
+		return rawConn, nil, nil
+	}
+	return rawConn, credentials.TLSInfo{
+		State:          cs.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+func (terminatedCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls", SecurityVersion: "1.2"}
+}
+
+func (c terminatedCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (terminatedCredentials) OverrideServerName(string) error {
+	return nil
+}
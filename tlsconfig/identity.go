@@ -0,0 +1,91 @@
+package tlsconfig
+
+import (
+	"context"
+	"net/url"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Identity is the identity of a peer taken from its verified certificate.
+type Identity struct {
+	// SPIFFEID is the spiffe:// URI SAN of the certificate, if any.
+	SPIFFEID   string
+	CommonName string
+	URIs       []*url.URL
+	DNSNames   []string
+}
+
+// String returns the SPIFFE ID when present, the common name otherwise.
+func (i Identity) String() string {
+	if i.SPIFFEID != "" {
+		return i.SPIFFEID
+	}
+	return i.CommonName
+}
+
+type keyIdentity struct{}
+
+// FromContext returns the identity of the calling client.
+func FromContext(ctx context.Context) (identity Identity, ok bool) {
+	identity, ok = ctx.Value(keyIdentity{}).(Identity)
+	return
+}
+
+// NewContext ...
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, keyIdentity{}, identity)
+}
+
+// PeerIdentity returns the identity of the peer of a gRPC call from its
+// verified client certificate.
+func PeerIdentity(ctx context.Context) (Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	identity := Identity{
+		CommonName: cert.Subject.CommonName,
+		URIs:       cert.URIs,
+		DNSNames:   cert.DNSNames,
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			identity.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return identity, true
+}
+
+// UnaryServerInterceptor puts the verified client identity in the request context.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if identity, ok := PeerIdentity(ctx); ok {
+			ctx = NewContext(ctx, identity)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor puts the verified client identity in the stream context.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		identity, ok := PeerIdentity(stream.Context())
+		if !ok {
+			return handler(srv, stream)
+		}
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = NewContext(stream.Context(), identity)
+		return handler(srv, wrapped)
+	}
+}
@@ -0,0 +1,247 @@
+// Package tlsconfig builds TLS and mutual TLS configurations for gRPC servers
+// and clients from certificate files, reloading them when the files rotate.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReloadInterval is the minimum time between two checks of the
+	// certificate files for changes.
+	DefaultReloadInterval = 10 * time.Second
+)
+
+// Reloader holds a certificate key pair and a CA bundle loaded from files.
+// The files are checked for changes at most once per interval, when a TLS
+// handshake needs them, so rotated certificates are picked up by new
+// connections without restarting.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+	lastErr   error
+}
+
+// NewReloader loads the given files. certFile and keyFile may be empty for a
+// client without a certificate, caFile may be empty to use the system roots
+// on clients and to not verify client certificates on servers.
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		interval: DefaultReloadInterval,
+		modTimes: make(map[string]time.Time),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// WithInterval ...
+func (r *Reloader) WithInterval(interval time.Duration) *Reloader {
+	r.interval = interval
+	return r
+}
+
+// Err returns the error of the last failed reload, if any. The previously
+// loaded certificates stay in use while reloading fails.
+func (r *Reloader) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastErr
+}
+
+// HasCertificate ...
+func (r *Reloader) HasCertificate() bool {
+	return r.certFile != ""
+}
+
+// HasCA ...
+func (r *Reloader) HasCA() bool {
+	return r.caFile != ""
+}
+
+// Certificate returns the current certificate key pair.
+func (r *Reloader) Certificate() (*tls.Certificate, error) {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return nil, fmt.Errorf("tlsconfig: no certificate configured")
+	}
+	return r.cert, nil
+}
+
+// ServerName returns a name the current certificate is valid for: its first
+// DNS name, else its first IP address, else its common name. It is empty
+// without a certificate.
+func (r *Reloader) ServerName() string {
+	cert, err := r.Certificate()
+	if err != nil || len(cert.Certificate) == 0 {
+		return ""
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return ""
+	}
+	switch {
+	case len(leaf.DNSNames) > 0:
+		return leaf.DNSNames[0]
+	case len(leaf.IPAddresses) > 0:
+		return leaf.IPAddresses[0].String()
+	}
+	return leaf.Subject.CommonName
+}
+
+// CertPool returns the current CA bundle, nil when no CA file is configured.
+func (r *Reloader) CertPool() *x509.CertPool {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+func (r *Reloader) files() []string {
+	var files []string
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (r *Reloader) maybeReload() {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= r.interval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	changed := false
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			r.lastErr = err
+			r.mu.Unlock()
+			return
+		}
+		if !fi.ModTime().Equal(r.modTimes[f]) {
+			changed = true
+		}
+	}
+	r.mu.Unlock()
+
+	if changed {
+		if err := r.load(); err != nil {
+			r.mu.Lock()
+			r.lastErr = err
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *Reloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTimes[f] = fi.ModTime()
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("tlsconfig: load key pair: %v", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tlsconfig: no certificate found in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	r.lastErr = nil
+	r.mu.Unlock()
+
+	return nil
+}
+
+// ServerConfig returns a server tls.Config resolving the certificate and the
+// client CAs on every handshake. With a CA file, client certificates are
+// required and verified against it.
+func (r *Reloader) ServerConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, err := r.Certificate()
+			if err != nil {
+				return nil, err
+			}
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if pool := r.CertPool(); pool != nil {
+				cfg.ClientCAs = pool
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig returns a client tls.Config with the current CA bundle. The
+// client certificate, if any, is resolved on every handshake.
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		RootCAs:    r.CertPool(),
+	}
+	if r.HasCertificate() {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.Certificate()
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,174 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, cn string, uri string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.issue(t, 2, "first", "")
+	writeFile(t, certFile, certPEM, time.Now().Add(-time.Minute))
+	writeFile(t, keyFile, keyPEM, time.Now().Add(-time.Minute))
+	writeFile(t, caFile, ca.pem, time.Now().Add(-time.Minute))
+
+	r, err := NewReloader(certFile, keyFile, caFile)
+	require.NoError(t, err)
+	r.WithInterval(0)
+
+	cert, err := r.Certificate()
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, "first", leaf.Subject.CommonName)
+	require.Equal(t, "localhost", r.ServerName())
+
+	t.Run("Rotate", func(t *testing.T) {
+		certPEM, keyPEM := ca.issue(t, 3, "second", "")
+		writeFile(t, certFile, certPEM, time.Now())
+		writeFile(t, keyFile, keyPEM, time.Now())
+
+		cert, err := r.Certificate()
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		require.Equal(t, "second", leaf.Subject.CommonName)
+		require.NoError(t, r.Err())
+	})
+
+	t.Run("Keep previous on invalid file", func(t *testing.T) {
+		writeFile(t, keyFile, []byte("garbage"), time.Now().Add(time.Second))
+
+		cert, err := r.Certificate()
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		require.Equal(t, "second", leaf.Subject.CommonName)
+		require.Error(t, r.Err())
+	})
+}
+
+func TestMutualTLSIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	newReloader := func(name, uri string) *Reloader {
+		certPEM, keyPEM := ca.issue(t, time.Now().UnixNano(), name, uri)
+		certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+		writeFile(t, certFile, certPEM, time.Now())
+		writeFile(t, keyFile, keyPEM, time.Now())
+		r, err := NewReloader(certFile, keyFile, caFile)
+		require.NoError(t, err)
+		return r
+	}
+	server := NewServerCredentials(newReloader("server", ""))
+	client := NewClientCredentials(newReloader("client", "spiffe://example.org/ns/default/sa/client"), "localhost")
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	type result struct {
+		info credentials.AuthInfo
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		_, info, err := server.ServerHandshake(serverConn)
+		done <- result{info, err}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err = client.ClientHandshake(ctx, "localhost:443", clientConn)
+	require.NoError(t, err)
+
+	res := <-done
+	require.NoError(t, res.err)
+
+	identity, ok := PeerIdentity(peer.NewContext(ctx, &peer.Peer{AuthInfo: res.info}))
+	require.True(t, ok)
+	require.Equal(t, "client", identity.CommonName)
+	require.Equal(t, "spiffe://example.org/ns/default/sa/client", identity.String())
+}
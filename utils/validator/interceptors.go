@@ -0,0 +1,106 @@
+package validator
+
+import (
+	"context"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validatable is implemented by messages with custom validation, including
+// the ones generated by protoc-gen-validate.
+type validatable interface {
+	Validate() error
+}
+
+// fieldError is implemented by the errors of protoc-gen-validate.
+type fieldError interface {
+	Field() string
+	Reason() string
+}
+
+// UnaryServerInterceptor validates the request messages, see ValidateRequest.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := ValidateRequest(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor validates every message received from the client,
+// see ValidateRequest.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: stream})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return ValidateRequest(m)
+}
+
+// ValidateRequest checks req with its `valid` struct tags (see Check), then
+// with its Validate method if any. It returns a codes.InvalidArgument status
+// carrying an errdetails.BadRequest with the field violations, or nil.
+func ValidateRequest(req interface{}) error {
+	if err := Check(req); err != nil {
+		return invalidArgument(err)
+	}
+	if v, ok := req.(validatable); ok {
+		if err := v.Validate(); err != nil {
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			return invalidArgument(err)
+		}
+	}
+	return nil
+}
+
+func invalidArgument(err error) error {
+	badRequest := &errdetails.BadRequest{FieldViolations: fieldViolations(err)}
+
+	st := status.New(codes.InvalidArgument, err.Error())
+	if len(badRequest.FieldViolations) > 0 {
+		if withDetails, derr := st.WithDetails(badRequest); derr == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+func fieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	switch e := err.(type) {
+	case govalidator.Errors:
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, err := range e {
+			violations = append(violations, fieldViolations(err)...)
+		}
+		return violations
+	case govalidator.Error:
+		field := append(append([]string{}, e.Path...), e.Name)
+		return []*errdetails.BadRequest_FieldViolation{{
+			Field:       strings.Join(field, "."),
+			Description: e.Err.Error(),
+		}}
+	case fieldError:
+		return []*errdetails.BadRequest_FieldViolation{{
+			Field:       e.Field(),
+			Description: e.Reason(),
+		}}
+	}
+	return nil
+}
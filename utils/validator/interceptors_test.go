@@ -0,0 +1,55 @@
+package validator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type address struct {
+	City string `json:"city,omitempty" valid:"name"`
+}
+
+type createUserRequest struct {
+	Phone   string   `json:"phone,omitempty" valid:"phone"`
+	Address *address `json:"address,omitempty"`
+	Age     int32    `json:"age,omitempty"`
+}
+
+func (r *createUserRequest) Validate() error {
+	if r.Age < 0 {
+		return errors.New("age must be positive")
+	}
+	return nil
+}
+
+func TestValidateRequest(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		require.NoError(t, ValidateRequest(&createUserRequest{Phone: "0123456789", Address: &address{City: "Hanoi"}}))
+	})
+
+	t.Run("Struct tags", func(t *testing.T) {
+		err := ValidateRequest(&createUserRequest{Phone: "123", Address: &address{City: "!"}})
+		st, _ := status.FromError(err)
+		require.Equal(t, codes.InvalidArgument, st.Code())
+		require.Len(t, st.Details(), 1)
+
+		badRequest := st.Details()[0].(*errdetails.BadRequest)
+		var fields []string
+		for _, v := range badRequest.FieldViolations {
+			fields = append(fields, v.Field)
+		}
+		require.ElementsMatch(t, []string{"phone", "Address.city"}, fields)
+	})
+
+	t.Run("Validate method", func(t *testing.T) {
+		err := ValidateRequest(&createUserRequest{Phone: "0123456789", Age: -1})
+		st, _ := status.FromError(err)
+		require.Equal(t, codes.InvalidArgument, st.Code())
+		require.Equal(t, "age must be positive", st.Message())
+	})
+}